@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/francoispqt/gojay"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
 	"github.com/quic-go/quic-go/qlog"
+	mathrand "math/rand/v2"
 	"net"
 	"os"
 	"os/signal"
@@ -15,7 +18,6 @@ import (
 	qlog2 "qperf-go/common/qlog"
 	"qperf-go/common/qlog_app"
 	"qperf-go/perf"
-	"qperf-go/perf/perf_client"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -26,17 +28,27 @@ type Client interface {
 	// Context is done when all tasks are finished or Close is called manually
 	Context() context.Context
 	TotalReport() common.Report
+	// RemoteResults returns the results of the server, received when closing.
+	// Returns nil if not available.
+	RemoteResults() *perf.Results
+	// TTFBSeries returns the distributions of a repeated time to first byte measurement, see Config.Repeat.
+	// Returns nil if not available.
+	TTFBSeries() *common.TTFBSeriesEvent
+	// Err returns the error that stopped the client, nil if it stopped regularly.
+	// Only valid after the Context is done.
+	Err() error
 	Close()
 }
 
 type client struct {
-	totalReceivedStreamBytesByPreviousPerfConns uint64
-	totalSentStreamBytesByPreviousPerfConns     uint64
-	perfClient                                  perf_client.Client
-	state                                       *common.State
-	config                                      *Config
-	qlog                                        qlog2.Writer
-	closeOnce                                   sync.Once
+	// parallel perf connections
+	conns     []*connection
+	state     *common.State
+	config    *Config
+	qlog      qlog2.Writer
+	closeOnce sync.Once
+	// only set within closeOnce
+	err error
 	// closed when client is stopping and doing some final output and cleanup
 	stopping       chan struct{}
 	streamLoopDone chan struct{}
@@ -46,12 +58,21 @@ type client struct {
 	finishedStreamRequests atomic.Uint64
 	// number of stream requests that have been started
 	startedStreamRequests atomic.Uint64
-	// closed when first perf client is ready to use
-	perfClientReady chan struct{}
-	// closed when the reconnect loop has stopped
-	reconnectLoopDone chan struct{}
+	// used to distribute requests over all connections
+	requestConnectionCounter atomic.Uint64
+	// samples the lengths of requests and responses and the Poisson arrivals, seeded by Config.Seed
+	seededRandMutex sync.Mutex
+	seededRand      *mathrand.Rand
+	// results of the server, nil if not available
+	remoteResults *perf.Results
+	// nil if Config.JSONSummary is not set
+	summary *summary
+	// nil if Config.Repeat is not set, available when the stream loop is done
+	ttfbSeries *common.TTFBSeriesEvent
 	// closed when the report loop has stopped
 	reportLoopDone chan struct{}
+	// goroutines of recordStateEvent, the qlog is closed when they are done
+	stateEvents sync.WaitGroup
 }
 
 func (c *client) Context() context.Context {
@@ -61,14 +82,13 @@ func (c *client) Context() context.Context {
 // Dial starts a new client
 func Dial(conf *Config) Client {
 	c := &client{
-		state:             common.NewState(),
-		config:            conf.Populate(),
-		stopping:          make(chan struct{}),
-		streamLoopDone:    make(chan struct{}),
-		perfClientReady:   make(chan struct{}),
-		reconnectLoopDone: make(chan struct{}),
-		reportLoopDone:    make(chan struct{}),
+		state:          common.NewState(),
+		config:         conf.Populate(),
+		stopping:       make(chan struct{}),
+		streamLoopDone: make(chan struct{}),
+		reportLoopDone: make(chan struct{}),
 	}
+	c.seededRand = mathrand.New(mathrand.NewPCG(c.config.Seed, c.config.Seed))
 	c.qperfCtx, c.cancelQperfCtx = context.WithCancel(context.Background())
 
 	if c.qlog == nil {
@@ -78,7 +98,18 @@ func Dial(conf *Config) Client {
 	}
 
 	if c.qlog == nil {
-		c.qlog = qlog2.NewStdoutQlogWriter(c.config.QlogConfig)
+		if c.config.JSONSummary {
+			c.qlog = qlog2.NewNopWriter(c.config.QlogConfig)
+		} else {
+			c.qlog = common.NewStdoutWriter(c.config.OutputFormat, c.config.PrintRaw, c.config.QlogConfig)
+		}
+	}
+
+	if c.config.JSONSummary {
+		c.summary = &summary{
+			config:        c.config,
+			referenceTime: c.qlog.ReferenceTime(),
+		}
 	}
 
 	var tracers []func(ctx context.Context, perspective logging.Perspective, connectionID logging.ConnectionID) *logging.ConnectionTracer
@@ -89,8 +120,6 @@ func Dial(conf *Config) Client {
 
 	tracers = append(tracers, qlog.DefaultConnectionTracer)
 
-	tracers = append(tracers, common.NewStateTracer(c.state).TracerForConnection)
-
 	tracers = append(tracers, func(_ context.Context, _ logging.Perspective, _ logging.ConnectionID) *logging.ConnectionTracer {
 		return &logging.ConnectionTracer{
 			StartedConnection: func(_, _ net.Addr, _, destConnID logging.ConnectionID) {
@@ -109,20 +138,31 @@ func Dial(conf *Config) Client {
 	if c.config.TlsConfig.ClientSessionCache != nil {
 		panic("unexpected value")
 	}
-	if c.config.Use0RTT {
+	if c.config.SessionCachePath != "" {
+		sessionCache, err := common.NewPersistentSessionCache(c.config.SessionCachePath)
+		if err != nil {
+			panic(fmt.Errorf("failed to load session cache: %w", err))
+		}
+		c.config.TlsConfig.ClientSessionCache = sessionCache
+		if c.config.Use0RTT && sessionCache.Len() == 0 {
+			c.qlog.RecordEvent(qlog_app.AppInfoEvent{Message: "no stored session ticket, 0-RTT is not possible until the next run"})
+		}
+	} else if c.config.Use0RTT {
 		c.config.TlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
 	}
 
 	if c.config.QuicConfig.TokenStore != nil {
 		panic("unexpected value")
 	}
+	// tokens are not persisted, quic.ClientToken does not expose its data
 	if c.config.Use0RTT {
 		c.config.QuicConfig.TokenStore = quic.NewLRUTokenStore(1, 1)
 	}
 
 	c.config.QuicConfig.Tracer = common.NewMultiplexedTracer(tracers...)
 
-	if c.config.Use0RTT {
+	// a stored session ticket is used instead of a warm-up connection
+	if c.config.Use0RTT && c.config.SessionCachePath == "" {
 		err := common.PingToGatherSessionTicketAndToken(
 			c.qperfCtx,
 			c.config.RemoteAddress,
@@ -141,26 +181,25 @@ func Dial(conf *Config) Client {
 
 	c.state.SetStartTime()
 
-	go func() {
-	reconnectLoop:
-		for {
-			select {
-			case <-c.stopping:
-				break reconnectLoop
-			default:
-				err := c.runConn()
-				if err != nil {
-					panic(err)
-				}
-			}
+	if c.config.repeatsTTFB() {
+		go func() {
+			c.runTTFBSeries()
+			close(c.streamLoopDone)
+		}()
+	} else {
+		for i := 0; i < c.config.Connections; i++ {
+			c.conns = append(c.conns, newConnection(i, c))
+		}
+		// a failing connection closes all connections
+		for _, conn := range c.conns {
+			conn.start()
 		}
-		close(c.reconnectLoopDone)
-	}()
 
-	go func() {
-		c.runRequestLoop()
-		close(c.streamLoopDone)
-	}()
+		go func() {
+			c.runRequestLoop()
+			close(c.streamLoopDone)
+		}()
+	}
 
 	go func() {
 		err := c.Run()
@@ -173,130 +212,6 @@ func Dial(conf *Config) Client {
 	return c
 }
 
-func (c *client) runConn() error {
-	if c.perfClient != nil {
-		c.state.ResetForReconnect()
-		c.qlog.RecordEvent(qlog_app.AppInfoEvent{Message: "reconnect"})
-		c.totalSentStreamBytesByPreviousPerfConns += c.perfClient.SentBytes()
-		c.totalReceivedStreamBytesByPreviousPerfConns += c.perfClient.ReceivedBytes()
-	}
-	var err error
-	c.perfClient, err = perf_client.DialAddr(
-		c.config.RemoteAddress,
-		&perf_client.Config{
-			QuicConfig: c.config.QuicConfig,
-			TlsConfig:  c.config.TlsConfig,
-			Qlog:       c.qlog,
-		},
-		c.config.Use0RTT)
-	if err != nil {
-		return err
-	}
-
-	select {
-	case <-c.perfClientReady:
-	default:
-		close(c.perfClientReady)
-	}
-
-	go func() {
-		c.state.AwaitHandshakeCompleted()
-		c.qlog.RecordEventAtTime(c.state.HandshakeCompletedTime(), common.HandshakeCompletedEvent{})
-	}()
-
-	go func() {
-		c.state.AwaitHandshakeConfirmed()
-		c.qlog.RecordEventAtTime(c.state.HandshakeConfirmedTime(), common.HandshakeConfirmedEvent{})
-	}()
-
-	if c.config.ReceiveInfiniteStream {
-		_, _, err := c.perfClient.Request(0, perf.MaxResponseLength, 0)
-		if err != nil {
-			c.handlePerfClose(err)
-		}
-	}
-
-	if c.config.SendInfiniteStream {
-		_, _, err := c.perfClient.Request(perf.MaxRequestLength, 0, 0)
-		if err != nil {
-			c.handlePerfClose(err)
-		}
-	}
-
-	if c.config.ReceiveDatagram {
-		panic("implement me")
-	}
-
-	if c.config.SendDatagram {
-		panic("implement me")
-	}
-	go func() {
-		c.state.AwaitFirstByteReceived()
-		c.qlog.RecordEventAtTime(c.state.FirstByteReceivedTime(), common.FirstAppDataReceivedEvent{})
-	}()
-	go func() {
-		c.state.AwaitFirstByteSent()
-		c.qlog.RecordEventAtTime(c.state.FirstByteSentTime(), common.FirstAppDataSentEvent{})
-	}()
-
-	select {
-	case <-c.perfClient.Context().Done():
-	case <-c.stopping:
-	}
-	err = c.perfClient.Close()
-	c.handlePerfClose(err)
-	return nil
-}
-
-func (c *client) runRequestLoop() {
-	if c.config.RequestLength == 0 && c.config.ResponseLength == 0 {
-		return
-	}
-	<-c.perfClientReady
-	var respWG sync.WaitGroup
-requestLoop:
-	for {
-		respWG.Add(1)
-		go func() {
-			defer c.finishedStreamRequests.Add(1)
-			defer respWG.Done()
-			req, resp, err := c.perfClient.Request(c.config.RequestLength, c.config.ResponseLength, c.config.ResponseDelay)
-			if err != nil {
-				c.handlePerfClose(err)
-				return // cancel current request
-			}
-			select {
-			case <-req.Context().Done():
-			case <-time.After(c.config.RequestDeadline):
-				req.Cancel()
-				resp.Cancel()
-				// exceeded deadlines will be counted in the next step
-			}
-			select {
-			case <-resp.Context().Done():
-				if resp.Success() {
-					c.state.AddReceivedResponses(1)
-				}
-			case <-time.After(c.config.ResponseDeadline):
-				req.Cancel()
-				resp.Cancel()
-				c.state.AddDeadlineExceededResponses(1)
-			}
-		}()
-		c.startedStreamRequests.Add(1)
-		if c.startedStreamRequests.Load() >= c.config.NumRequests {
-			break requestLoop
-		}
-		select {
-		case <-c.stopping:
-			break requestLoop
-		default:
-		}
-		time.Sleep(c.config.RequestInterval)
-	}
-	respWG.Wait()
-}
-
 func (c *client) Run() error {
 
 	// close gracefully on interrupt (CTRL+C)
@@ -307,15 +222,23 @@ func (c *client) Run() error {
 		c.Close()
 	}()
 
+	// the test ends with the last request if there is no infinite stream or datagram flow
+	var requestsDone <-chan struct{}
 	if !c.config.SendInfiniteStream && !c.config.ReceiveInfiniteStream && !c.config.ReceiveDatagram && !c.config.SendDatagram {
-		go func() {
-			<-c.streamLoopDone
-			c.Close()
-		}()
+		requestsDone = c.streamLoopDone
 	}
 
-	if c.config.TimeToFirstByteOnly {
-		c.state.AwaitFirstByteReceived()
+	if c.config.repeatsTTFB() {
+		select {
+		case <-c.streamLoopDone:
+		case <-c.stopping:
+		}
+	} else if c.config.TimeToFirstByteOnly {
+		select {
+		case <-c.state.FirstByteReceivedChan():
+		case <-requestsDone:
+		case <-c.stopping:
+		}
 	} else {
 
 		endTime := c.state.StartTime().Add(c.config.ProbeTime)
@@ -327,22 +250,52 @@ func (c *client) Run() error {
 				c.report(c.state, false)
 			case <-endTimeChan:
 				break loop
+			case <-requestsDone:
+				break loop
 			case <-c.stopping:
 				break loop
 			}
 		}
 	}
 
+	// results are only requested if the test ended regularly, not if it was closed or failed
+	select {
+	case <-c.stopping:
+	default:
+		if !c.config.TimeToFirstByteOnly && !c.config.repeatsTTFB() && perf.SupportsExtensions(c.config.TlsConfig.NextProtos[0]) {
+			c.remoteResults = c.requestResults()
+		}
+	}
 	c.close(nil)
 	return nil
 }
 
+// quicConfig returns the QUIC config of the parallel connection with the given index,
+// its state tracer records the transport metrics of this connection.
+func (c *client) quicConfig(connection int) *quic.Config {
+	stateTracer := common.NewStateTracer(c.state)
+	stateTracer.Connection = connection
+	if perf.SupportsExtensions(c.config.TlsConfig.NextProtos[0]) {
+		controlStream := perf.ControlStreamID
+		stateTracer.ControlStream = &controlStream
+	}
+	stateTracer.OnFlowControlBlocked = func(event common.FlowControlBlockedEvent) {
+		c.qlog.RecordEvent(event)
+	}
+	quicConfig := c.config.QuicConfig.Clone()
+	quicConfig.Tracer = common.NewMultiplexedTracer(c.config.QuicConfig.Tracer, stateTracer.TracerForConnection)
+	return quicConfig
+}
+
 func (c *client) report(state *common.State, total bool) {
 	var report common.Report
-	if c.perfClient != nil {
-		state.SetTotalReceiveStreamBytes(c.totalReceivedStreamBytesByPreviousPerfConns + c.perfClient.ReceivedBytes())
-		state.SetTotalSentStreamBytes(c.totalSentStreamBytesByPreviousPerfConns + c.perfClient.SentBytes())
+	var receivedBytes, sentBytes uint64
+	for _, conn := range c.conns {
+		receivedBytes += conn.receivedBytes.total()
+		sentBytes += conn.sentBytes.total()
 	}
+	state.SetTotalReceiveStreamBytes(receivedBytes)
+	state.SetTotalSentStreamBytes(sentBytes)
 	if total {
 		report = state.TotalReport()
 	} else {
@@ -351,46 +304,265 @@ func (c *client) report(state *common.State, total bool) {
 	now := time.Now()
 	event := &common.ReportEvent{
 		Period: report.TimeAggregated,
-		//PacketsReceived:   &report.ReceivedPackets,
-		//MinRTT: &report.MinRTT,
 	}
-	if c.config.ReportMaxRTT {
+	if c.config.ReportPacketsReceived {
+		event.PacketsReceived = &report.ReceivedPackets
+	}
+	if c.config.ReportMinRTT && report.HasRTT() {
+		event.MinRTT = &report.MinRTT
+	}
+	if c.config.ReportMaxRTT && report.HasRTT() {
 		event.MaxRTT = &report.MaxRTT
 	}
+	if c.config.ReportSmoothedRTT {
+		event.SmoothedRTT = &report.SmoothedRTT
+	}
+	if c.config.ReportRTTVariance {
+		event.RTTVariance = &report.RTTVariance
+	}
+	if c.config.ReportLatestRTT {
+		event.LatestRTT = &report.LatestRTT
+	}
+	if c.config.ReportCongestionMetrics && report.CongestionWindow.Samples != 0 {
+		event.CongestionWindow = &report.CongestionWindow
+		event.BytesInFlight = &report.BytesInFlight
+	}
+	if c.config.ReportFlowControl {
+		event.FlowControlBlockedSending = &report.FlowControlBlockedSending
+		event.FlowControlBlockedReceiving = &report.FlowControlBlockedReceiving
+		sending := c.config.SendInfiniteStream || c.config.sendsRequests() || c.config.SendDatagram
+		if limitedBy := report.LimitedBy(sending); limitedBy != "" {
+			event.LimitedBy = &limitedBy
+		}
+	}
 	if c.config.ReportLostPackets {
 		event.PacketsLost = &report.PacketsLost
 	}
-	if c.config.ResponseLength != 0 || c.config.ReceiveInfiniteStream {
-		mbps := float32(report.ReceivedBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+	if c.config.receivesResponses() || c.config.ReceiveInfiniteStream {
+		mbps := megaBitsPerSecond(report.ReceivedBytes, report.TimeAggregated)
 		event.StreamMegaBitsPerSecondReceived = &mbps
 		event.StreamBytesReceived = &report.ReceivedBytes
 	}
 	if c.config.ReceiveDatagram {
-		mbps := float32(report.ReceivedDatagramBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		mbps := megaBitsPerSecond(report.ReceivedDatagramBytes, report.TimeAggregated)
 		event.DatagramMegaBitsPerSecondReceived = &mbps
 		event.DatagramBytesReceived = &report.ReceivedDatagramBytes
-	}
-	if c.config.RequestLength != 0 || c.config.SendInfiniteStream {
-		mbps := float32(report.SentBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		lossPercentage := report.DatagramLossPercentage()
+		event.DatagramsReceived = &report.ReceivedDatagrams
+		event.DatagramsLost = &report.LostDatagrams
+		event.DatagramLossPercentage = &lossPercentage
+		event.DatagramsOutOfOrder = &report.OutOfOrderDatagrams
+		event.DatagramsDuplicate = &report.DuplicateDatagrams
+		event.DatagramJitter = &report.DatagramJitter
+	}
+	if c.config.sendsRequests() || c.config.SendInfiniteStream {
+		mbps := megaBitsPerSecond(report.SentBytes, report.TimeAggregated)
 		event.StreamMegaBitsPerSecondSent = &mbps
 		event.StreamBytesSent = &report.SentBytes
 	}
 	if c.config.SendDatagram {
-		mbps := float32(report.SentDatagramBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		mbps := megaBitsPerSecond(report.SentDatagramBytes, report.TimeAggregated)
 		event.DatagramMegaBitsPerSecondSent = &mbps
 		event.DatagramBytesSent = &report.SentDatagramBytes
 	}
 	if c.config.NumRequests > 1 {
 		event.ResponsesReceived = &report.ReceivedResponses
 	}
+	if c.config.sendsRequests() || c.config.receivesResponses() {
+		event.RequestLatency = &report.RequestLatency
+	}
+	if _, fixed := c.config.RequestLength.(common.FixedSize); (c.config.RequestLength != nil && !fixed) || len(c.config.Workload) != 0 {
+		event.RequestLength = &report.RequestLength
+	}
+	if _, fixed := c.config.ResponseLength.(common.FixedSize); (c.config.ResponseLength != nil && !fixed) || len(c.config.Workload) != 0 {
+		event.ResponseLength = &report.ResponseLength
+	}
 	if report.DeadlineExceededResponses != 0 {
 		event.DeadlineExceededResponses = &report.DeadlineExceededResponses
 	}
+	if len(c.conns) > 1 {
+		event.Connections = c.connectionReports(report.TimeAggregated, total)
+	}
+	if c.config.ParallelStreams > 1 {
+		event.Streams = c.streamReports(report.TimeAggregated, total)
+	}
+	if total && c.config.Use0RTT {
+		event.ZeroRTT = &report.ZeroRTT
+		c.qlog.RecordEventAtTime(now, common.ZeroRTTEvent{ZeroRTTStats: report.ZeroRTT})
+	}
+	if total && c.config.Verify {
+		event.Verification = &report.Verification
+	}
 	if total {
-		c.qlog.RecordEventAtTime(now, common.TotalEvent{ReportEvent: *event})
+		totalEvent := common.TotalEvent{ReportEvent: *event}
+		if c.remoteResults != nil {
+			totalEvent.Remote = c.remoteReportEvent(*c.remoteResults)
+		}
+		c.qlog.RecordEventAtTime(now, totalEvent)
+		if c.summary != nil {
+			c.summary.total = &totalEvent
+		}
 	} else {
 		c.qlog.RecordEventAtTime(now, event)
+		if c.config.CSV != nil {
+			err := c.config.CSV.Write(now, event)
+			if err != nil {
+				c.qlog.RecordEvent(qlog_app.AppErrorEvent{Message: fmt.Sprintf("failed to write csv report: %s", err)})
+			}
+		}
+		if c.summary != nil {
+			c.summary.reports = append(c.summary.reports, summaryReport{time: now.Sub(c.summary.referenceTime), event: event})
+		}
+	}
+}
+
+// bytesOf returns the total bytes of the counter if total is set, otherwise the bytes of the current interval
+func bytesOf(counter *flowCounter, total bool) logging.ByteCount {
+	if total {
+		return logging.ByteCount(counter.total())
+	}
+	return logging.ByteCount(counter.getAndResetInterval())
+}
+
+func megaBitsPerSecond(bytes logging.ByteCount, period time.Duration) float32 {
+	return float32(bytes) * 8 / float32(period.Seconds()) / float32(1e6)
+}
+
+func (c *client) connectionReports(period time.Duration, total bool) []common.ConnectionReport {
+	var reports []common.ConnectionReport
+	for _, conn := range c.conns {
+		report := common.ConnectionReport{Connection: conn.index}
+		if c.config.receivesResponses() || c.config.ReceiveInfiniteStream {
+			bytes := bytesOf(&conn.receivedBytes, total)
+			mbps := megaBitsPerSecond(bytes, period)
+			report.StreamBytesReceived = &bytes
+			report.StreamMegaBitsPerSecondReceived = &mbps
+		}
+		if c.config.sendsRequests() || c.config.SendInfiniteStream {
+			bytes := bytesOf(&conn.sentBytes, total)
+			mbps := megaBitsPerSecond(bytes, period)
+			report.StreamBytesSent = &bytes
+			report.StreamMegaBitsPerSecondSent = &mbps
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (c *client) streamReports(period time.Duration, total bool) []common.StreamReport {
+	var reports []common.StreamReport
+	for _, conn := range c.conns {
+		for i := 0; i < c.config.ParallelStreams; i++ {
+			report := common.StreamReport{Connection: conn.index, Stream: i}
+			if c.config.ReceiveInfiniteStream {
+				bytes := bytesOf(conn.receiveStreams[i], total)
+				mbps := megaBitsPerSecond(bytes, period)
+				report.BytesReceived = &bytes
+				report.MegaBitsPerSecondReceived = &mbps
+			}
+			if c.config.SendInfiniteStream {
+				bytes := bytesOf(conn.sendStreams[i], total)
+				mbps := megaBitsPerSecond(bytes, period)
+				report.BytesSent = &bytes
+				report.MegaBitsPerSecondSent = &mbps
+			}
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// requestResults returns the sum of the results of the current perf connections.
+// Returns nil if not all servers responded within ResultsTimeout or the client is closed meanwhile.
+func (c *client) requestResults() *perf.Results {
+	ctx, cancel := context.WithTimeout(c.qperfCtx, ResultsTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var sum perf.Results
+	for _, conn := range c.conns {
+		perfClient := conn.PerfClient()
+		if perfClient == nil {
+			return nil
+		}
+		results, err := perfClient.RequestResults(ctx)
+		if err != nil {
+			c.qlog.RecordEvent(qlog_app.AppInfoEvent{Message: fmt.Sprintf("failed to receive results from server: %s", err)})
+			return nil
+		}
+		sum = sum.Add(results)
+	}
+	return &sum
+}
+
+// remoteReportEvent contains the metrics of the server for the directions used by the client
+func (c *client) remoteReportEvent(results perf.Results) *common.ReportEvent {
+	event := &common.ReportEvent{
+		Period: results.Duration,
+	}
+	if c.config.sendsRequests() || c.config.SendInfiniteStream {
+		bytes := logging.ByteCount(results.ReceivedStreamBytes)
+		mbps := megaBitsPerSecond(bytes, results.Duration)
+		event.StreamBytesReceived = &bytes
+		event.StreamMegaBitsPerSecondReceived = &mbps
+	}
+	if c.config.receivesResponses() || c.config.ReceiveInfiniteStream {
+		bytes := logging.ByteCount(results.SentStreamBytes)
+		mbps := megaBitsPerSecond(bytes, results.Duration)
+		event.StreamBytesSent = &bytes
+		event.StreamMegaBitsPerSecondSent = &mbps
 	}
+	if c.config.Verify {
+		event.Verification = &common.VerificationStats{
+			StreamsVerified: results.VerifiedStreams,
+			StreamsFailed:   results.FailedStreams,
+			BytesVerified:   results.VerifiedBytes,
+		}
+	}
+	if c.config.SendDatagram {
+		bytes := logging.ByteCount(results.ReceivedDatagramBytes)
+		mbps := megaBitsPerSecond(bytes, results.Duration)
+		event.DatagramBytesReceived = &bytes
+		event.DatagramMegaBitsPerSecondReceived = &mbps
+		event.DatagramsReceived = &results.ReceivedDatagrams
+	}
+	return event
+}
+
+// recordVerification counts the verified response streams and reports the first mismatch
+func (c *client) recordVerification(result perf.VerificationResult) {
+	c.state.AddVerificationResult(int64(result.StreamID), result.VerifiedBytes, result.Complete, result.Failed)
+	if result.Failed {
+		c.qlog.RecordEvent(common.VerificationFailedEvent{
+			StreamID:  int64(result.StreamID),
+			Direction: "response",
+			Offset:    result.MismatchOffset,
+		})
+	}
+}
+
+// recordStateEvent records the event at the time returned by eventTime once done is closed.
+// The event is dropped if the client stops before.
+func (c *client) recordStateEvent(done <-chan struct{}, eventTime func() time.Time, event qlog2.EventDetails) {
+	c.stateEvents.Add(1)
+	go func() {
+		defer c.stateEvents.Done()
+		select {
+		case <-done:
+		case <-c.stopping:
+			select {
+			case <-done:
+			default:
+				return
+			}
+		}
+		c.qlog.RecordEventAtTime(eventTime(), event)
+	}()
 }
 
 func (c *client) handlePerfClose(err error) {
@@ -415,30 +587,56 @@ func (c *client) close(err error) {
 			} else if _, ok := err.(*quic.ApplicationError); ok {
 				// close regularly
 			} else if _, ok := err.(*quic.StatelessResetError); ok {
-				c.perfClient.Close()
+				// close regularly
+			} else if errors.Is(err, quic.Err0RTTRejected) {
+				// reported by the zero_rtt event
+				c.qlog.RecordEvent(qlog_app.AppErrorEvent{Message: "0-RTT rejected by the server"})
 			} else {
-				panic(fmt.Errorf("close with error: %s", err).Error())
-			}
-			if c.perfClient != nil {
-				c.perfClient.Close()
-			}
-		} else {
-			if c.perfClient != nil {
-				c.perfClient.Close()
+				// e.g. a perf.ControlError, a protocol error of the server or a failed reconnect
+				c.qlog.RecordEvent(qlog_app.AppErrorEvent{Message: err.Error()})
+				c.err = err
 			}
 		}
+		for _, conn := range c.conns {
+			conn.close()
+		}
 		go func() {
-			<-c.reconnectLoopDone
+			for _, conn := range c.conns {
+				<-conn.reconnectLoopDone
+			}
 			<-c.streamLoopDone
 			<-c.reportLoopDone
+			c.stateEvents.Wait()
 			c.report(c.state, true)
+			if c.config.CSV != nil {
+				err := c.config.CSV.Close()
+				if err != nil {
+					c.qlog.RecordEvent(qlog_app.AppErrorEvent{Message: fmt.Sprintf("failed to write csv report: %s", err)})
+				}
+			}
 			c.qlog.Close()
+			if c.summary != nil {
+				c.printSummary()
+			}
 			// flush qlog
 			c.cancelQperfCtx()
 		}()
 	})
 }
 
+func (c *client) printSummary() {
+	c.summary.handshakeCompletedTime = c.state.HandshakeCompletedTime()
+	c.summary.handshakeConfirmedTime = c.state.HandshakeConfirmedTime()
+	c.summary.firstByteSentTime = c.state.FirstByteSentTime()
+	c.summary.firstByteReceivedTime = c.state.FirstByteReceivedTime()
+	c.summary.ttfbSeries = c.ttfbSeries
+	enc := gojay.NewEncoder(os.Stdout)
+	if err := enc.EncodeObject(c.summary); err != nil {
+		panic(fmt.Sprintf("summary encoding failed: %s", err))
+	}
+	fmt.Println()
+}
+
 func (c *client) CloseWithError(err error) {
 	c.close(err)
 	<-c.qperfCtx.Done()
@@ -451,3 +649,15 @@ func (c *client) Close() {
 func (c *client) TotalReport() common.Report {
 	return c.state.TotalReport()
 }
+
+func (c *client) Err() error {
+	return c.err
+}
+
+func (c *client) RemoteResults() *perf.Results {
+	return c.remoteResults
+}
+
+func (c *client) TTFBSeries() *common.TTFBSeriesEvent {
+	return c.ttfbSeries
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
 	"math"
+	"qperf-go/common"
 	qlog2 "qperf-go/common/qlog"
 	"qperf-go/perf"
 	"runtime/debug"
@@ -17,6 +18,10 @@ const (
 	DefaultReportInterval = 1 * time.Second
 	DefaultQlogTitle      = "qperf"
 	DefaultDeadline       = time.Duration(math.MaxInt64)
+	// ResultsTimeout is the maximum time to wait for the results of the server when closing
+	ResultsTimeout = time.Second
+	// DefaultMaxInFlight limits the outstanding requests of the open request loop
+	DefaultMaxInFlight = 100
 )
 
 func getDefaultQlogCodeVersion() string {
@@ -28,32 +33,98 @@ func getDefaultQlogCodeVersion() string {
 }
 
 type Config struct {
-	TimeToFirstByteOnly   bool
-	ProbeTime             time.Duration
-	ReportInterval        time.Duration
-	Use0RTT               bool
+	TimeToFirstByteOnly bool
+	// Repeat measures the time to first byte of this number of fresh connections, one after another.
+	// Only used with TimeToFirstByteOnly.
+	Repeat int
+	// RepeatInterval is the time between the end of a connection of Repeat and the start of the next one
+	RepeatInterval time.Duration
+	ProbeTime      time.Duration
+	ReportInterval time.Duration
+	Use0RTT        bool
+	// SessionCachePath persists TLS session tickets in this file, to resume sessions across runs.
+	// With Use0RTT, the stored ticket is used instead of a warm-up connection.
+	SessionCachePath      string
 	LogPrefix             string
 	SendInfiniteStream    bool
 	ReceiveInfiniteStream bool
 	SendDatagram          bool
 	ReceiveDatagram       bool
 	// QlogConfig only applies to the perf qlog, not to quic-go
-	QlogConfig                *qlog2.Config
-	RemoteAddress             string
-	TlsConfig                 *tls.Config
-	ReportLostPackets         bool
-	ReportMaxRTT              bool
+	QlogConfig *qlog2.Config
+	// OutputFormat of stdout, if QLOGDIR is not set
+	OutputFormat common.OutputFormat
+	// PrintRaw disables metric prefixes in the text output
+	PrintRaw bool
+	// JSONSummary prints a single JSON document to stdout when the client exits, instead of the OutputFormat.
+	// The document contains the config, the handshake timings, all reports and the total.
+	JSONSummary bool
+	// CSV, if set, receives every interval report as a row, it is closed by the client
+	CSV                   *common.CSVReportWriter
+	RemoteAddress         string
+	TlsConfig             *tls.Config
+	ReportLostPackets     bool
+	ReportMaxRTT          bool
+	ReportMinRTT          bool
+	ReportSmoothedRTT     bool
+	ReportRTTVariance     bool
+	ReportLatestRTT       bool
+	ReportPacketsReceived bool
+	// ReportCongestionMetrics includes the congestion window and bytes in flight in the reports
+	ReportCongestionMetrics bool
+	// ReportFlowControl includes the time blocked by flow control and what limited the throughput in the reports
+	ReportFlowControl         bool
 	QuicConfig                *quic.Config
 	ReconnectOnTimeoutOrReset bool
-	RequestLength             uint64
-	ResponseLength            uint64
-	RequestInterval           time.Duration
+	// RequestLength is the distribution of the bytes sent per request.
+	// Requests are sent if RequestLength or ResponseLength is set.
+	RequestLength common.SizeDistribution
+	// ResponseLength is the distribution of the bytes received per response
+	ResponseLength common.SizeDistribution
+	// Workload replays requests at the offsets of its entries, instead of RequestLength and ResponseLength.
+	// NumRequests is set to the number of entries.
+	Workload []WorkloadEntry
+	// Seed of the random number generator that samples RequestLength, ResponseLength and the PoissonArrivals
+	Seed            uint64
+	RequestInterval time.Duration
 	// RequestDeadline resets the stream if the request cannot be sent due to insufficient window sizes within the deadline
 	RequestDeadline time.Duration
 	// ResponseDeadline resets the stream if the response is not received within the deadline
 	ResponseDeadline time.Duration
 	ResponseDelay    time.Duration
 	NumRequests      uint64
+	// RequestRate starts requests at this rate per second, independent of the completion of previous requests (open loop).
+	// 0 disables the open loop, RequestInterval is used instead.
+	RequestRate float64
+	// PoissonArrivals uses exponentially distributed times between the requests of RequestRate, instead of fixed ones
+	PoissonArrivals bool
+	// MaxInFlight limits the outstanding requests of RequestRate, negative means unlimited.
+	// Further requests are delayed, which is included in their latency.
+	// Defaults to DefaultMaxInFlight.
+	MaxInFlight int
+	// Concurrency keeps this number of requests outstanding, starting a new one when one is completed (closed loop).
+	// 0 disables the closed loop.
+	Concurrency int
+	// RequestEvents records a qperf:request_completed event for every successful request
+	RequestEvents bool
+	// Bitrate limits every sending stream and datagram flow of client and server, in bits per second.
+	// 0 means unlimited.
+	Bitrate uint64
+	// Burst is the burst size of the pacer in bytes.
+	// 0 means default.
+	Burst uint64
+	// ParallelStreams is the number of infinite streams per direction and connection
+	ParallelStreams int
+	// Connections is the number of parallel perf connections
+	Connections int
+	// Emulation impairs the packets of all connections, nil if disabled
+	Emulation *common.EmulationConfig
+	// DatagramSize is the size of payload datagrams in both directions, 0 means perf.DefaultDatagramSize
+	DatagramSize uint64
+	// Verify sends a pseudo-random pattern on all streams, which is checked by the receiver
+	Verify bool
+	// Payload of request streams, nil means perf.ZeroPayload
+	Payload perf.Payload
 }
 
 func (c *Config) Populate() *Config {
@@ -64,7 +135,7 @@ func (c *Config) Populate() *Config {
 		c.TlsConfig = &tls.Config{}
 	}
 	if c.TlsConfig.NextProtos == nil {
-		c.TlsConfig.NextProtos = []string{perf.ALPN}
+		c.TlsConfig.NextProtos = []string{perf.QperfALPN}
 	}
 	if c.QlogConfig == nil {
 		c.QlogConfig = &qlog2.Config{}
@@ -83,11 +154,17 @@ func (c *Config) Populate() *Config {
 		c.QuicConfig = &quic.Config{}
 		c.QuicConfig.EnableDatagrams = true
 	}
+	if c.SendDatagram || c.ReceiveDatagram {
+		c.QuicConfig.EnableDatagrams = true
+	}
 	if c.ReportInterval == 0 {
 		c.ReportInterval = time.Duration(math.MaxInt64)
 	}
+	if len(c.Workload) != 0 {
+		c.NumRequests = uint64(len(c.Workload))
+	}
 	if c.NumRequests == 0 {
-		if c.RequestInterval == 0 {
+		if c.RequestInterval == 0 && c.RequestRate == 0 && c.Concurrency == 0 {
 			c.NumRequests = 1
 		} else {
 			c.NumRequests = math.MaxUint64
@@ -96,6 +173,15 @@ func (c *Config) Populate() *Config {
 	if c.ProbeTime == 0 {
 		c.ProbeTime = time.Duration(math.MaxInt64)
 	}
+	if c.ParallelStreams == 0 {
+		c.ParallelStreams = 1
+	}
+	if c.Connections == 0 {
+		c.Connections = 1
+	}
+	if c.MaxInFlight == 0 {
+		c.MaxInFlight = DefaultMaxInFlight
+	}
 	if c.RequestDeadline == 0 {
 		c.RequestDeadline = DefaultDeadline
 	}
@@ -104,3 +190,33 @@ func (c *Config) Populate() *Config {
 	}
 	return c
 }
+
+// sendsRequests returns true if request streams are sent
+func (c *Config) sendsRequests() bool {
+	return c.RequestLength != nil || len(c.Workload) != 0
+}
+
+// receivesResponses returns true if response streams are received
+func (c *Config) receivesResponses() bool {
+	return c.ResponseLength != nil || len(c.Workload) != 0
+}
+
+// testDescription is sent to the server on the control stream of every connection
+func (c *Config) testDescription() *perf.TestDescription {
+	description := &perf.TestDescription{}
+	if c.ProbeTime != MaxProbeTime {
+		description.Duration = c.ProbeTime
+	}
+	if c.SendInfiniteStream || c.SendDatagram || c.sendsRequests() {
+		description.Direction |= perf.DirectionUpload
+	}
+	if c.ReceiveInfiniteStream || c.ReceiveDatagram || c.receivesResponses() {
+		description.Direction |= perf.DirectionDownload
+	}
+	return description
+}
+
+// repeatsTTFB returns true if the time to first byte is measured for a series of connections
+func (c *Config) repeatsTTFB() bool {
+	return c.TimeToFirstByteOnly && c.Repeat > 1
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"fmt"
+	"qperf-go/common"
+	"qperf-go/common/qlog_app"
+	"qperf-go/perf"
+	"qperf-go/perf/perf_client"
+	"sync"
+	"time"
+)
+
+// connection is one of the parallel perf connections of the client.
+// The underlying perf client is replaced on reconnect.
+type connection struct {
+	// index within the parallel connections, also used as datagram flow
+	index  int
+	client *client
+	mutex  sync.Mutex
+	// only access while holding mutex
+	perfClient    perf_client.Client
+	receivedBytes flowCounter
+	sentBytes     flowCounter
+	// bytes of the parallel infinite streams, the index is kept on reconnect
+	receiveStreams []*flowCounter
+	sendStreams    []*flowCounter
+	// closed when first perf client is ready to use
+	perfClientReady chan struct{}
+	// closed when the reconnect loop has stopped
+	reconnectLoopDone chan struct{}
+}
+
+func newConnection(index int, client *client) *connection {
+	c := &connection{
+		index:             index,
+		client:            client,
+		receiveStreams:    make([]*flowCounter, client.config.ParallelStreams),
+		sendStreams:       make([]*flowCounter, client.config.ParallelStreams),
+		perfClientReady:   make(chan struct{}),
+		reconnectLoopDone: make(chan struct{}),
+	}
+	for i := range c.receiveStreams {
+		c.receiveStreams[i] = &flowCounter{}
+		c.sendStreams[i] = &flowCounter{}
+	}
+	return c
+}
+
+// start runs the reconnect loop, the connections of the client must not be modified afterwards
+func (c *connection) start() {
+	go func() {
+		c.runReconnectLoop()
+		close(c.reconnectLoopDone)
+	}()
+}
+
+// PerfClient returns nil if the first perf client is not ready yet
+func (c *connection) PerfClient() perf_client.Client {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.perfClient
+}
+
+func (c *connection) runReconnectLoop() {
+	for {
+		select {
+		case <-c.client.stopping:
+			return
+		default:
+			err := c.runConn()
+			if err != nil {
+				// the dial failed, the client stops with the error
+				c.client.close(err)
+				return
+			}
+		}
+	}
+}
+
+func (c *connection) runConn() error {
+	state := c.client.state
+	config := c.client.config
+	if c.PerfClient() != nil {
+		state.ResetForReconnect()
+		state.ResetDatagramFlow(c.index)
+		c.client.qlog.RecordEvent(qlog_app.AppInfoEvent{Message: "reconnect"})
+	}
+	perfClient, err := perf_client.DialAddr(
+		config.RemoteAddress,
+		&perf_client.Config{
+			QuicConfig: c.client.quicConfig(c.index),
+			TlsConfig:  config.TlsConfig,
+			Qlog:       c.client.qlog,
+			OnDatagramReceive: func(sequenceNumber uint64, sendTime time.Time, receiveTime time.Time) {
+				state.AddReceivedDatagram(c.index, sequenceNumber, sendTime, receiveTime)
+			},
+			Bitrate:         config.Bitrate,
+			Burst:           config.Burst,
+			Emulation:       config.Emulation,
+			DatagramSize:    config.DatagramSize,
+			TestDescription: config.testDescription(),
+			Verify:          config.Verify,
+			Payload:         config.Payload,
+			OnVerification:  c.client.recordVerification,
+		},
+		config.Use0RTT)
+	if err != nil {
+		// wrapped, a timeout of the handshake is not a regular close
+		return fmt.Errorf("failed to dial: %w", err)
+	}
+	c.mutex.Lock()
+	c.perfClient = perfClient
+	c.mutex.Unlock()
+	c.client.trackZeroRTT(perfClient)
+	c.receivedBytes.set(perfClient.ReceivedBytes)
+	c.sentBytes.set(perfClient.SentBytes)
+
+	select {
+	case <-c.perfClientReady:
+	default:
+		close(c.perfClientReady)
+	}
+
+	// the handshake and first byte events are only reported for the first connection
+	if c.index == 0 {
+		c.client.recordStateEvent(state.HandshakeCompletedChan(), state.HandshakeCompletedTime, common.HandshakeCompletedEvent{})
+		c.client.recordStateEvent(state.HandshakeConfirmedChan(), state.HandshakeConfirmedTime, common.HandshakeConfirmedEvent{})
+	}
+
+	if config.ReceiveInfiniteStream {
+		for _, counter := range c.receiveStreams {
+			_, resp, err := perfClient.Request(0, perf.MaxResponseLength, 0)
+			if err != nil {
+				c.client.handlePerfClose(err)
+				break
+			}
+			counter.set(resp.ReceivedBytes)
+		}
+	}
+
+	if config.SendInfiniteStream {
+		for _, counter := range c.sendStreams {
+			req, _, err := perfClient.Request(perf.MaxRequestLength, 0, 0)
+			if err != nil {
+				c.client.handlePerfClose(err)
+				break
+			}
+			counter.set(req.SentBytes)
+		}
+	}
+
+	if config.ReceiveDatagram {
+		err := perfClient.RequestDatagrams()
+		if err != nil {
+			c.client.handlePerfClose(err)
+		}
+	}
+
+	if config.SendDatagram {
+		perfClient.SendDatagrams()
+	}
+
+	if c.index == 0 {
+		c.client.recordStateEvent(state.FirstByteReceivedChan(), state.FirstByteReceivedTime, common.FirstAppDataReceivedEvent{})
+		c.client.recordStateEvent(state.FirstByteSentChan(), state.FirstByteSentTime, common.FirstAppDataSentEvent{})
+	}
+
+	select {
+	case <-perfClient.Context().Done():
+	case <-c.client.stopping:
+	}
+	err = perfClient.Close()
+	c.client.handlePerfClose(err)
+	return nil
+}
+
+// close the current perf client, if any
+func (c *connection) close() {
+	perfClient := c.PerfClient()
+	if perfClient != nil {
+		perfClient.Close()
+	}
+}
+
+// trackZeroRTT counts the connection as accepted by the server if it used 0-RTT, once the handshake completed
+func (c *client) trackZeroRTT(perfClient perf_client.Client) {
+	go func() {
+		select {
+		case <-perfClient.HandshakeComplete():
+		case <-perfClient.Context().Done():
+			select {
+			case <-perfClient.HandshakeComplete():
+			default:
+				return
+			}
+		}
+		if perfClient.QuicConn().ConnectionState().Used0RTT {
+			c.state.AddZeroRTTAccepted()
+		}
+	}()
+}
@@ -0,0 +1,48 @@
+package client
+
+import "sync"
+
+// flowCounter sums up the bytes of a flow whose source is replaced, e.g. on reconnect.
+// It also calculates the bytes per report interval.
+type flowCounter struct {
+	mutex sync.Mutex
+	// bytes of previous sources
+	previous uint64
+	// nil if not set yet
+	current         func() uint64
+	lastReportTotal uint64
+}
+
+// set replaces the current source.
+func (f *flowCounter) set(current func() uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.current != nil {
+		f.previous += f.current()
+	}
+	f.current = current
+}
+
+func (f *flowCounter) total() uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.totalLocked()
+}
+
+// must only be called while holding the lock
+func (f *flowCounter) totalLocked() uint64 {
+	if f.current == nil {
+		return f.previous
+	}
+	return f.previous + f.current()
+}
+
+// getAndResetInterval returns the bytes since the last call.
+func (f *flowCounter) getAndResetInterval() uint64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	total := f.totalLocked()
+	interval := total - f.lastReportTotal
+	f.lastReportTotal = total
+	return interval
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"qperf-go/common"
+	"sync"
+	"time"
+)
+
+func (c *client) runRequestLoop() {
+	if !c.config.sendsRequests() && !c.config.receivesResponses() {
+		return
+	}
+	switch {
+	case len(c.config.Workload) != 0:
+		c.runWorkloadRequestLoop()
+	case c.config.Concurrency != 0:
+		c.runClosedRequestLoop()
+	case c.config.RequestRate != 0:
+		c.runOpenRequestLoop()
+	default:
+		c.runIntervalRequestLoop()
+	}
+}
+
+// runIntervalRequestLoop sleeps for RequestInterval between starting requests
+func (c *client) runIntervalRequestLoop() {
+	var respWG sync.WaitGroup
+requestLoop:
+	for {
+		conn := c.nextRequestConnection()
+		if conn == nil {
+			break requestLoop
+		}
+		respWG.Add(1)
+		go func() {
+			defer respWG.Done()
+			c.sampledRequest(conn, time.Now())
+		}()
+		c.startedStreamRequests.Add(1)
+		if c.startedStreamRequests.Load() >= c.config.NumRequests {
+			break requestLoop
+		}
+		select {
+		case <-c.stopping:
+			break requestLoop
+		default:
+		}
+		time.Sleep(c.config.RequestInterval)
+	}
+	respWG.Wait()
+}
+
+// runOpenRequestLoop starts requests at RequestRate, independent of the completion of previous requests.
+// The latency is measured from the intended start time,
+// so delays caused by the scheduler or by MaxInFlight are included (coordinated omission correction).
+func (c *client) runOpenRequestLoop() {
+	var respWG sync.WaitGroup
+	var inFlight chan struct{}
+	if c.config.MaxInFlight > 0 {
+		inFlight = make(chan struct{}, c.config.MaxInFlight)
+	}
+	intendedStart := time.Now()
+requestLoop:
+	for {
+		select {
+		case <-time.After(time.Until(intendedStart)):
+		case <-c.stopping:
+			break requestLoop
+		}
+		if inFlight != nil {
+			select {
+			case inFlight <- struct{}{}:
+			case <-c.stopping:
+				break requestLoop
+			}
+		}
+		conn := c.nextRequestConnection()
+		if conn == nil {
+			break requestLoop
+		}
+		respWG.Add(1)
+		go func(intendedStart time.Time) {
+			defer respWG.Done()
+			c.sampledRequest(conn, intendedStart)
+			if inFlight != nil {
+				<-inFlight
+			}
+		}(intendedStart)
+		if c.startedStreamRequests.Add(1) >= c.config.NumRequests {
+			break requestLoop
+		}
+		intendedStart = intendedStart.Add(c.nextInterarrivalTime())
+	}
+	respWG.Wait()
+}
+
+// runWorkloadRequestLoop starts the requests of the Workload at their offsets.
+// Like runOpenRequestLoop, the latency is measured from the intended start time.
+func (c *client) runWorkloadRequestLoop() {
+	var respWG sync.WaitGroup
+	workloadStart := time.Now()
+requestLoop:
+	for i, entry := range c.config.Workload {
+		intendedStart := workloadStart.Add(entry.Offset)
+		select {
+		case <-time.After(time.Until(intendedStart)):
+		case <-c.stopping:
+			break requestLoop
+		}
+		conn := c.nextRequestConnection()
+		if conn == nil {
+			break requestLoop
+		}
+		respWG.Add(1)
+		go func() {
+			defer respWG.Done()
+			result, latency := c.request(conn, intendedStart, entry.RequestLength, entry.ResponseLength, entry.ResponseDelay)
+			event := common.WorkloadEntryFinishedEvent{
+				Entry:  i,
+				Offset: entry.Offset,
+				Result: result,
+			}
+			if result == common.RequestResultCompleted {
+				event.Latency = &latency
+			}
+			c.qlog.RecordEvent(event)
+		}()
+		c.startedStreamRequests.Add(1)
+	}
+	respWG.Wait()
+}
+
+// nextInterarrivalTime returns the time between the intended starts of two requests
+func (c *client) nextInterarrivalTime() time.Duration {
+	mean := float64(time.Second) / c.config.RequestRate
+	if c.config.PoissonArrivals {
+		c.seededRandMutex.Lock()
+		defer c.seededRandMutex.Unlock()
+		return time.Duration(c.seededRand.ExpFloat64() * mean)
+	}
+	return time.Duration(mean)
+}
+
+// runClosedRequestLoop keeps Concurrency requests outstanding,
+// a new request is started as soon as the previous one is completed.
+func (c *client) runClosedRequestLoop() {
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-c.stopping:
+					return
+				default:
+				}
+				if !c.claimRequest() {
+					return
+				}
+				conn := c.nextRequestConnection()
+				if conn == nil {
+					return
+				}
+				c.sampledRequest(conn, time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// claimRequest increments startedStreamRequests, returns false if NumRequests are already started
+func (c *client) claimRequest() bool {
+	for {
+		started := c.startedStreamRequests.Load()
+		if started >= c.config.NumRequests {
+			return false
+		}
+		if c.startedStreamRequests.CompareAndSwap(started, started+1) {
+			return true
+		}
+	}
+}
+
+// nextRequestConnection distributes requests over all connections and waits until the connection is ready.
+// Returns nil if the client is stopping.
+func (c *client) nextRequestConnection() *connection {
+	conn := c.conns[(c.requestConnectionCounter.Add(1)-1)%uint64(len(c.conns))]
+	select {
+	case <-conn.perfClientReady:
+		return conn
+	case <-c.stopping:
+		return nil
+	}
+}
+
+// sampleLengths returns the lengths of the next request and its response, 0 if not set
+func (c *client) sampleLengths() (requestLength uint64, responseLength uint64) {
+	c.seededRandMutex.Lock()
+	defer c.seededRandMutex.Unlock()
+	if c.config.RequestLength != nil {
+		requestLength = c.config.RequestLength.Sample(c.seededRand)
+	}
+	if c.config.ResponseLength != nil {
+		responseLength = c.config.ResponseLength.Sample(c.seededRand)
+	}
+	return requestLength, responseLength
+}
+
+// sampledRequest sends a request with sampled lengths and waits for the response
+func (c *client) sampledRequest(conn *connection, start time.Time) {
+	requestLength, responseLength := c.sampleLengths()
+	c.request(conn, start, requestLength, responseLength, c.config.ResponseDelay)
+}
+
+// request sends a request and waits for the response.
+// The latency is measured from start and only valid if the request is completed.
+func (c *client) request(conn *connection, start time.Time, requestLength uint64, responseLength uint64, responseDelay time.Duration) (result string, latency time.Duration) {
+	defer c.finishedStreamRequests.Add(1)
+	c.state.AddRequestLengths(requestLength, responseLength)
+	req, resp, err := conn.PerfClient().Request(requestLength, responseLength, responseDelay)
+	if err != nil {
+		c.handlePerfClose(err)
+		return common.RequestResultFailed, 0 // cancel current request
+	}
+	requestDeadlineExceeded := false
+	select {
+	case <-req.Context().Done():
+	case <-time.After(c.config.RequestDeadline):
+		req.Cancel()
+		resp.Cancel()
+		requestDeadlineExceeded = true
+	}
+	select {
+	case <-resp.Context().Done():
+		if resp.Success() {
+			latency = time.Since(start)
+			c.state.AddReceivedResponses(1)
+			c.state.AddRequestLatency(latency)
+			if c.config.RequestEvents {
+				c.qlog.RecordEvent(common.RequestCompletedEvent{
+					StreamID:       resp.StreamID(),
+					RequestLength:  requestLength,
+					ResponseLength: responseLength,
+					RequestBytes:   req.SentBytes(),
+					ResponseBytes:  resp.ReceivedBytes(),
+					Latency:        latency,
+				})
+			}
+			return common.RequestResultCompleted, latency
+		}
+		if requestDeadlineExceeded {
+			c.state.AddDeadlineExceededResponses(1)
+			return common.RequestResultDeadlineExceeded, 0
+		}
+		return common.RequestResultFailed, 0
+	case <-time.After(c.config.ResponseDeadline):
+		req.Cancel()
+		resp.Cancel()
+		c.state.AddDeadlineExceededResponses(1)
+		return common.RequestResultDeadlineExceeded, 0
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"github.com/francoispqt/gojay"
+	"qperf-go/common"
+	"time"
+)
+
+// summary is printed as a single JSON document when the client exits, see Config.JSONSummary.
+// All times are in milliseconds relative to the reference time, like in the qlog events.
+type summary struct {
+	config        *Config
+	referenceTime time.Time
+	// zero if not reached
+	handshakeCompletedTime time.Time
+	handshakeConfirmedTime time.Time
+	firstByteSentTime      time.Time
+	firstByteReceivedTime  time.Time
+	reports                summaryReports
+	total                  *common.TotalEvent
+	// nil if Config.Repeat is not set
+	ttfbSeries *common.TTFBSeriesEvent
+}
+
+func (s *summary) IsNil() bool { return s == nil }
+func (s *summary) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.ObjectKey("config", summaryConfig{s.config})
+	enc.Float64Key("reference_time", float64(s.referenceTime.UnixNano())/1e6)
+	s.timeKeyOmitEmpty(enc, "handshake_completed", s.handshakeCompletedTime)
+	s.timeKeyOmitEmpty(enc, "handshake_confirmed", s.handshakeConfirmedTime)
+	s.timeKeyOmitEmpty(enc, "first_app_data_sent", s.firstByteSentTime)
+	s.timeKeyOmitEmpty(enc, "first_app_data_received", s.firstByteReceivedTime)
+	if s.ttfbSeries != nil {
+		enc.ObjectKey("ttfb_series", s.ttfbSeries)
+	}
+	enc.ArrayKey("reports", s.reports)
+	if s.total != nil {
+		enc.ObjectKey("total", s.total)
+	}
+}
+
+func (s *summary) timeKeyOmitEmpty(enc *gojay.Encoder, key string, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	enc.Float64Key(key, milliseconds(t.Sub(s.referenceTime)))
+}
+
+// summaryReport is a report event with the time it was recorded
+type summaryReport struct {
+	time  time.Duration
+	event *common.ReportEvent
+}
+
+func (r summaryReport) IsNil() bool { return false }
+func (r summaryReport) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Float64Key("time", milliseconds(r.time))
+	r.event.MarshalJSONObject(enc)
+}
+
+type summaryReports []summaryReport
+
+func (r summaryReports) IsNil() bool { return false }
+func (r summaryReports) MarshalJSONArray(enc *gojay.Encoder) {
+	for _, report := range r {
+		enc.Object(report)
+	}
+}
+
+// summaryConfig contains the parts of the config that influence the measurement
+type summaryConfig struct {
+	*Config
+}
+
+func (c summaryConfig) IsNil() bool { return c.Config == nil }
+func (c summaryConfig) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.StringKey("remote_address", c.RemoteAddress)
+	enc.Float64Key("probe_time", milliseconds(c.ProbeTime))
+	enc.Float64Key("report_interval", milliseconds(c.ReportInterval))
+	enc.BoolKey("ttfb", c.TimeToFirstByteOnly)
+	if c.repeatsTTFB() {
+		enc.IntKey("repeat", c.Repeat)
+		enc.Float64Key("repeat_interval", milliseconds(c.RepeatInterval))
+	}
+	enc.BoolKey("0rtt", c.Use0RTT)
+	enc.BoolKey("session_cache", c.SessionCachePath != "")
+	enc.BoolKey("send_stream", c.SendInfiniteStream)
+	enc.BoolKey("receive_stream", c.ReceiveInfiniteStream)
+	enc.BoolKey("send_datagram", c.SendDatagram)
+	enc.BoolKey("receive_datagram", c.ReceiveDatagram)
+	enc.BoolKey("verify", c.Verify)
+	if c.Payload != nil {
+		enc.StringKey("payload", c.Payload.String())
+	}
+	if c.DatagramSize != 0 {
+		enc.Uint64Key("datagram_size", c.DatagramSize)
+	}
+	if c.RequestLength != nil {
+		enc.StringKey("request_length", c.RequestLength.String())
+	}
+	if c.ResponseLength != nil {
+		enc.StringKey("response_length", c.ResponseLength.String())
+	}
+	if len(c.Workload) != 0 {
+		enc.IntKey("workload_entries", len(c.Workload))
+	}
+	enc.Uint64Key("seed", c.Seed)
+	enc.Uint64Key("request_number", c.NumRequests)
+	enc.Float64Key("request_interval", milliseconds(c.RequestInterval))
+	enc.Float64Key("request_rate", c.RequestRate)
+	enc.BoolKey("poisson_arrivals", c.PoissonArrivals)
+	enc.IntKey("max_in_flight", c.MaxInFlight)
+	enc.IntKey("concurrency", c.Concurrency)
+	enc.Float64Key("response_delay", milliseconds(c.ResponseDelay))
+	enc.Uint64Key("bitrate", c.Bitrate)
+	enc.Uint64Key("burst", c.Burst)
+	enc.IntKey("parallel_streams", c.ParallelStreams)
+	enc.IntKey("connections", c.Connections)
+	enc.BoolKey("reconnect", c.ReconnectOnTimeoutOrReset)
+	if c.Emulation != nil {
+		enc.StringKey("emulate", c.Emulation.String())
+	}
+	if c.QuicConfig != nil {
+		enc.Uint64Key("initial_receive_window", c.QuicConfig.InitialStreamReceiveWindow)
+		enc.Uint64Key("max_receive_window", c.QuicConfig.MaxStreamReceiveWindow)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
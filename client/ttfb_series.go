@@ -0,0 +1,115 @@
+package client
+
+import (
+	"fmt"
+	"qperf-go/common"
+	"qperf-go/common/qlog_app"
+	"qperf-go/perf"
+	"qperf-go/perf/perf_client"
+	"time"
+)
+
+// runTTFBSeries measures the time to first byte of Config.Repeat fresh connections, one after another.
+// With Config.Use0RTT, every connection resumes the session of the previous one.
+func (c *client) runTTFBSeries() {
+	var handshakeCompleted, handshakeConfirmed, firstByteSent, firstByteReceived common.Histogram
+	attempts := 0
+	record := func(histogram *common.Histogram, t time.Time, start time.Time) *time.Duration {
+		if t.IsZero() {
+			return nil
+		}
+		d := t.Sub(start)
+		histogram.Record(d)
+		return &d
+	}
+seriesLoop:
+	for attempt := 0; attempt < c.config.Repeat; attempt++ {
+		if attempt != 0 {
+			select {
+			case <-time.After(c.config.RepeatInterval):
+			case <-c.stopping:
+				break seriesLoop
+			}
+		}
+		start, err := c.measureTTFB()
+		if err != nil {
+			c.qlog.RecordEvent(qlog_app.AppErrorEvent{Message: fmt.Sprintf("attempt %d: %s", attempt, err)})
+			continue
+		}
+		attempts++
+		c.qlog.RecordEvent(common.TTFBAttemptEvent{
+			Attempt:              attempt,
+			HandshakeCompleted:   record(&handshakeCompleted, c.state.HandshakeCompletedTime(), start),
+			HandshakeConfirmed:   record(&handshakeConfirmed, c.state.HandshakeConfirmedTime(), start),
+			FirstAppDataSent:     record(&firstByteSent, c.state.FirstByteSentTime(), start),
+			FirstAppDataReceived: record(&firstByteReceived, c.state.FirstByteReceivedTime(), start),
+		})
+	}
+	c.ttfbSeries = &common.TTFBSeriesEvent{
+		Attempts:             attempts,
+		HandshakeCompleted:   handshakeCompleted.Summary(),
+		HandshakeConfirmed:   handshakeConfirmed.Summary(),
+		FirstAppDataSent:     firstByteSent.Summary(),
+		FirstAppDataReceived: firstByteReceived.Summary(),
+	}
+	c.qlog.RecordEvent(*c.ttfbSeries)
+}
+
+// measureTTFB dials a new connection and closes it as soon as the first byte is received and the handshake is confirmed.
+// The timings are stored in the state, start is the time before dialing.
+func (c *client) measureTTFB() (start time.Time, err error) {
+	c.state.ResetForReconnect()
+	start = time.Now()
+	perfClient, err := perf_client.DialAddr(
+		c.config.RemoteAddress,
+		&perf_client.Config{
+			QuicConfig:      c.quicConfig(0),
+			TlsConfig:       c.config.TlsConfig,
+			Qlog:            c.qlog,
+			Bitrate:         c.config.Bitrate,
+			Burst:           c.config.Burst,
+			Emulation:       c.config.Emulation,
+			DatagramSize:    c.config.DatagramSize,
+			TestDescription: c.config.testDescription(),
+			Verify:          c.config.Verify,
+			Payload:         c.config.Payload,
+			OnVerification:  c.recordVerification,
+		},
+		c.config.Use0RTT)
+	if err != nil {
+		return start, err
+	}
+	defer perfClient.Close()
+	c.trackZeroRTT(perfClient)
+	switch {
+	case c.config.ReceiveInfiniteStream || c.config.SendInfiniteStream:
+		// separate streams, the server would only respond after an infinite request
+		if c.config.ReceiveInfiniteStream {
+			_, _, err = perfClient.Request(0, perf.MaxResponseLength, 0)
+		}
+		if err == nil && c.config.SendInfiniteStream {
+			_, _, err = perfClient.Request(perf.MaxRequestLength, 0, 0)
+		}
+	case c.config.sendsRequests() || c.config.receivesResponses():
+		requestLength, responseLength := c.sampleLengths()
+		_, _, err = perfClient.Request(requestLength, responseLength, c.config.ResponseDelay)
+	case c.config.ReceiveDatagram:
+		err = perfClient.RequestDatagrams()
+	}
+	if err != nil {
+		return start, err
+	}
+	if c.config.SendDatagram {
+		perfClient.SendDatagrams()
+	}
+	for _, done := range []<-chan struct{}{c.state.FirstByteReceivedChan(), c.state.HandshakeConfirmedChan()} {
+		select {
+		case <-done:
+		case <-perfClient.Context().Done():
+			return start, fmt.Errorf("connection closed before first byte was received")
+		case <-c.stopping:
+			return start, fmt.Errorf("stopped before first byte was received")
+		}
+	}
+	return start, nil
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/francoispqt/gojay"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WorkloadEntry is a request of a replayed trace
+type WorkloadEntry struct {
+	// Offset is the time after the start of the workload at which the request is sent
+	Offset         time.Duration
+	RequestLength  uint64
+	ResponseLength uint64
+	// ResponseDelay is the time that the server waits until responding
+	ResponseDelay time.Duration
+}
+
+// LoadWorkload reads the entries of a workload from a CSV or JSON file, depending on the file extension.
+// Times are in milliseconds.
+//
+// CSV files start with a header of the columns offset, request_bytes, response_bytes and optionally server_delay, in any order.
+// JSON files contain an array of objects with the same keys.
+//
+// The entries are sorted by their offset.
+func LoadWorkload(filepath string) ([]WorkloadEntry, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []WorkloadEntry
+	if strings.ToLower(path.Ext(filepath)) == ".json" {
+		var jsonEntries workloadJSON
+		err = gojay.NewDecoder(f).DecodeArray(&jsonEntries)
+		entries = jsonEntries
+	} else {
+		entries, err = readWorkloadCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no entries", filepath)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Offset < entries[j].Offset
+	})
+	return entries, nil
+}
+
+func readWorkloadCSV(r io.Reader) ([]WorkloadEntry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, column := range []string{"offset", "request_bytes", "response_bytes"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing column %s", column)
+		}
+	}
+	var entries []WorkloadEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		var entry WorkloadEntry
+		entry.Offset, err = parseMilliseconds(record[columns["offset"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse offset: %w", line, err)
+		}
+		entry.RequestLength, err = strconv.ParseUint(record[columns["request_bytes"]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse request_bytes: %w", line, err)
+		}
+		entry.ResponseLength, err = strconv.ParseUint(record[columns["response_bytes"]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse response_bytes: %w", line, err)
+		}
+		if i, ok := columns["server_delay"]; ok && record[i] != "" {
+			entry.ResponseDelay, err = parseMilliseconds(record[i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: failed to parse server_delay: %w", line, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func parseMilliseconds(s string) (time.Duration, error) {
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return millisecondsToDuration(ms)
+}
+
+func millisecondsToDuration(ms float64) (time.Duration, error) {
+	if ms < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+type workloadJSON []WorkloadEntry
+
+func (w *workloadJSON) UnmarshalJSONArray(dec *gojay.Decoder) error {
+	var entry workloadEntryJSON
+	err := dec.Object(&entry)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", len(*w), err)
+	}
+	// the same columns are required as in CSV files
+	for _, required := range []struct {
+		key string
+		ok  bool
+	}{{"offset", entry.hasOffset}, {"request_bytes", entry.hasRequestLength}, {"response_bytes", entry.hasResponseLength}} {
+		if !required.ok {
+			return fmt.Errorf("entry %d: missing %s", len(*w), required.key)
+		}
+	}
+	*w = append(*w, entry.WorkloadEntry)
+	return nil
+}
+
+type workloadEntryJSON struct {
+	WorkloadEntry
+	hasOffset         bool
+	hasRequestLength  bool
+	hasResponseLength bool
+}
+
+func (e *workloadEntryJSON) NKeys() int { return 0 }
+func (e *workloadEntryJSON) UnmarshalJSONObject(dec *gojay.Decoder, key string) error {
+	switch key {
+	case "offset":
+		var ms float64
+		err := dec.Float64(&ms)
+		if err != nil {
+			return err
+		}
+		e.hasOffset = true
+		e.Offset, err = millisecondsToDuration(ms)
+		if err != nil {
+			return fmt.Errorf("failed to parse offset: %w", err)
+		}
+		return nil
+	case "request_bytes":
+		e.hasRequestLength = true
+		return dec.Uint64(&e.RequestLength)
+	case "response_bytes":
+		e.hasResponseLength = true
+		return dec.Uint64(&e.ResponseLength)
+	case "server_delay":
+		var ms float64
+		err := dec.Float64(&ms)
+		if err != nil {
+			return err
+		}
+		e.ResponseDelay, err = millisecondsToDuration(ms)
+		if err != nil {
+			return fmt.Errorf("failed to parse server_delay: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseBitrateWithUnit returns the bitrate in bits per second.
+// It supports the following 10^3 based unit prefixes: k, m, g, t .
+// The prefix can be followed by "bit" or "bps", e.g. 50Mbit or 50mbps.
+// the unit suffix is case-insensitive.
+// no unit suffix will result in normal integer parsing.
+func ParseBitrateWithUnit(s string) (uint64, error) {
+	expr := regexp.MustCompile("^\\s*(\\d+)\\s*(\\w*)\\s*$")
+	match := expr.FindStringSubmatch(s)
+	if len(match) != 3 {
+		return 0, errors.New("failed to parse")
+	}
+	number, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	suffix := strings.ToLower(match[2])
+	suffix = strings.TrimSuffix(suffix, "bit")
+	suffix = strings.TrimSuffix(suffix, "bps")
+	var factor uint64
+	switch suffix {
+	case "":
+		factor = 1
+	case "k":
+		factor = 1e3
+	case "m":
+		factor = 1e6
+	case "g":
+		factor = 1e9
+	case "t":
+		factor = 1e12
+	default:
+		return 0, errors.New("invalid suffix")
+	}
+	if number > math.MaxUint64/factor {
+		return 0, errors.New("bitrate out of range")
+	}
+	return number * factor, nil
+}
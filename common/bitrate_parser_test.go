@@ -0,0 +1,25 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseBitrateWithUnit(t *testing.T) {
+	for s, expected := range map[string]uint64{
+		"1000":                 1000,
+		"50Mbit":               50_000_000,
+		"50mbps":               50_000_000,
+		"18446744073709551615": 18446744073709551615,
+		"18446744073G":         18_446_744_073_000_000_000,
+	} {
+		bitrate, err := ParseBitrateWithUnit(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, bitrate, s)
+	}
+	for _, s := range []string{"1x", "-1", "18446744074G", "99999999999999T", "99999999999999999999G"} {
+		_, err := ParseBitrateWithUnit(s)
+		assert.Error(t, err, s)
+	}
+}
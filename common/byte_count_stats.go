@@ -0,0 +1,63 @@
+package common
+
+import (
+	"github.com/francoispqt/gojay"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// ByteCountStats summarizes the samples of a metric like the congestion window
+type ByteCountStats struct {
+	// Current is the latest sample
+	Current logging.ByteCount
+	Min     logging.ByteCount
+	Max     logging.ByteCount
+	// Average is the mean of all samples, not weighted by time
+	Average logging.ByteCount
+	Samples uint64
+}
+
+func (s ByteCountStats) IsNil() bool { return false }
+func (s ByteCountStats) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Uint64Key("current", uint64(s.Current))
+	enc.Uint64Key("min", uint64(s.Min))
+	enc.Uint64Key("max", uint64(s.Max))
+	enc.Uint64Key("avg", uint64(s.Average))
+}
+
+// byteCountAggregator collects samples, the current value is kept on reset
+type byteCountAggregator struct {
+	current logging.ByteCount
+	min     logging.ByteCount
+	max     logging.ByteCount
+	sum     uint64
+	samples uint64
+}
+
+func (a *byteCountAggregator) add(value logging.ByteCount) {
+	if a.samples == 0 || value < a.min {
+		a.min = value
+	}
+	if a.samples == 0 || value > a.max {
+		a.max = value
+	}
+	a.current = value
+	a.sum += uint64(value)
+	a.samples++
+}
+
+func (a *byteCountAggregator) stats() ByteCountStats {
+	stats := ByteCountStats{
+		Current: a.current,
+		Min:     a.min,
+		Max:     a.max,
+		Samples: a.samples,
+	}
+	if a.samples != 0 {
+		stats.Average = logging.ByteCount(a.sum / a.samples)
+	}
+	return stats
+}
+
+func (a *byteCountAggregator) reset() {
+	*a = byteCountAggregator{current: a.current}
+}
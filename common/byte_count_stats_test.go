@@ -0,0 +1,18 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestByteCountAggregator(t *testing.T) {
+	var a byteCountAggregator
+	a.add(20)
+	a.add(10)
+	a.add(30)
+	assert.Equal(t, ByteCountStats{Current: 30, Min: 10, Max: 30, Average: 20, Samples: 3}, a.stats())
+	a.reset()
+	assert.Equal(t, ByteCountStats{Current: 30}, a.stats())
+	a.add(40)
+	assert.Equal(t, ByteCountStats{Current: 40, Min: 40, Max: 40, Average: 40, Samples: 1}, a.stats())
+}
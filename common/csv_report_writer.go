@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/csv"
+	"github.com/quic-go/quic-go/logging"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// CSVColumns are the fixed columns of the CSV report file.
+// Durations are in milliseconds.
+var CSVColumns = []string{
+	"timestamp",
+	"period",
+	"stream_bytes_received",
+	"stream_mbps_received",
+	"stream_bytes_sent",
+	"stream_mbps_sent",
+	"datagram_bytes_received",
+	"datagram_mbps_received",
+	"datagram_bytes_sent",
+	"datagram_mbps_sent",
+	"min_rtt",
+	"max_rtt",
+	"smoothed_rtt",
+	"packets_lost",
+	"responses_received",
+	"deadline_exceeded",
+}
+
+// CSVReportWriter writes one row per report.
+// Cells of metrics that are not included in a report are left blank.
+type CSVReportWriter struct {
+	file *os.File
+	w    *csv.Writer
+}
+
+// NewCSVReportWriter creates the file and writes the header row
+func NewCSVReportWriter(filepath string) (*CSVReportWriter, error) {
+	err := os.MkdirAll(path.Dir(filepath), 0700)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath)
+	if err != nil {
+		return nil, err
+	}
+	w := &CSVReportWriter{
+		file: f,
+		w:    csv.NewWriter(f),
+	}
+	err = w.w.Write(CSVColumns)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *CSVReportWriter) Write(time time.Time, event *ReportEvent) error {
+	return w.w.Write([]string{
+		time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		formatCSVDuration(&event.Period),
+		formatCSVByteCount(event.StreamBytesReceived),
+		formatCSVFloat(event.StreamMegaBitsPerSecondReceived),
+		formatCSVByteCount(event.StreamBytesSent),
+		formatCSVFloat(event.StreamMegaBitsPerSecondSent),
+		formatCSVByteCount(event.DatagramBytesReceived),
+		formatCSVFloat(event.DatagramMegaBitsPerSecondReceived),
+		formatCSVByteCount(event.DatagramBytesSent),
+		formatCSVFloat(event.DatagramMegaBitsPerSecondSent),
+		formatCSVDuration(event.MinRTT),
+		formatCSVDuration(event.MaxRTT),
+		formatCSVDuration(event.SmoothedRTT),
+		formatCSVUint(event.PacketsLost),
+		formatCSVUint(event.ResponsesReceived),
+		formatCSVUint(event.DeadlineExceededResponses),
+	})
+}
+
+// Close flushes the buffered rows and closes the file
+func (w *CSVReportWriter) Close() error {
+	w.w.Flush()
+	err := w.w.Error()
+	if err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func formatCSVDuration(d *time.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(d.Nanoseconds())/1e6, 'f', -1, 64)
+}
+
+func formatCSVByteCount(b *logging.ByteCount) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+func formatCSVFloat(f *float32) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*f), 'f', -1, 32)
+}
+
+func formatCSVUint(u *uint64) string {
+	if u == nil {
+		return ""
+	}
+	return strconv.FormatUint(*u, 10)
+}
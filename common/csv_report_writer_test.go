@@ -0,0 +1,35 @@
+package common
+
+import (
+	"encoding/csv"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSVReportWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	w, err := NewCSVReportWriter(path)
+	assert.NoError(t, err)
+	bytesSent := logging.ByteCount(1000)
+	mbpsSent := float32(8)
+	err = w.Write(time.Now(), &ReportEvent{
+		Period:                      time.Millisecond,
+		StreamBytesSent:             &bytesSent,
+		StreamMegaBitsPerSecondSent: &mbpsSent,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, CSVColumns, records[0])
+	assert.Equal(t, []string{"1", "", "", "1000", "8", "", "", "", "", "", "", "", "", "", ""}, records[1][1:])
+}
@@ -0,0 +1,76 @@
+package common
+
+import "time"
+
+// datagramWindowSize is the number of sequence numbers below the next expected one,
+// for which late and duplicated datagrams can be distinguished.
+const datagramWindowSize = 1024
+
+// datagramTracker detects lost, reordered and duplicated datagrams by their sequence numbers
+// and estimates the interarrival jitter as specified in RFC 3550 Section 6.4.1.
+// Not thread-safe.
+type datagramTracker struct {
+	nextSequenceNumber uint64
+	// ring buffer of received flags, indexed by sequence number
+	received       [datagramWindowSize / 64]uint64
+	lastTransit    time.Duration
+	hasLastTransit bool
+	jitter         time.Duration
+}
+
+// add returns the change in lost datagrams.
+// A late datagram reduces the number of previously assumed losses.
+func (t *datagramTracker) add(sequenceNumber uint64, sendTime time.Time, receiveTime time.Time) (lost int64, outOfOrder bool, duplicate bool) {
+	switch {
+	case sequenceNumber >= t.nextSequenceNumber:
+		gap := sequenceNumber - t.nextSequenceNumber
+		if gap >= datagramWindowSize {
+			t.received = [datagramWindowSize / 64]uint64{}
+		} else {
+			for n := t.nextSequenceNumber; n < sequenceNumber; n++ {
+				t.setReceived(n, false)
+			}
+		}
+		t.setReceived(sequenceNumber, true)
+		t.nextSequenceNumber = sequenceNumber + 1
+		lost = int64(gap)
+	case t.nextSequenceNumber-sequenceNumber > datagramWindowSize:
+		// too old to detect duplicates
+		lost = -1
+		outOfOrder = true
+	case t.isReceived(sequenceNumber):
+		return 0, false, true
+	default:
+		t.setReceived(sequenceNumber, true)
+		lost = -1
+		outOfOrder = true
+	}
+	t.updateJitter(receiveTime.Sub(sendTime))
+	return lost, outOfOrder, false
+}
+
+func (t *datagramTracker) updateJitter(transit time.Duration) {
+	if t.hasLastTransit {
+		d := transit - t.lastTransit
+		if d < 0 {
+			d = -d
+		}
+		t.jitter += (d - t.jitter) / 16
+	}
+	t.lastTransit = transit
+	t.hasLastTransit = true
+}
+
+func (t *datagramTracker) isReceived(sequenceNumber uint64) bool {
+	index := sequenceNumber % datagramWindowSize
+	return t.received[index/64]&(1<<(index%64)) != 0
+}
+
+func (t *datagramTracker) setReceived(sequenceNumber uint64, received bool) {
+	index := sequenceNumber % datagramWindowSize
+	if received {
+		t.received[index/64] |= 1 << (index % 64)
+	} else {
+		t.received[index/64] &^= 1 << (index % 64)
+	}
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDatagramTracker(t *testing.T) {
+	var tracker datagramTracker
+	sendTime := time.Now()
+	add := func(sequenceNumber uint64) (int64, bool, bool) {
+		return tracker.add(sequenceNumber, sendTime, sendTime.Add(time.Millisecond))
+	}
+	lost, outOfOrder, duplicate := add(0)
+	assert.Equal(t, int64(0), lost)
+	assert.False(t, outOfOrder)
+	assert.False(t, duplicate)
+	lost, _, _ = add(3)
+	assert.Equal(t, int64(2), lost)
+	lost, outOfOrder, duplicate = add(1)
+	assert.Equal(t, int64(-1), lost)
+	assert.True(t, outOfOrder)
+	assert.False(t, duplicate)
+	lost, outOfOrder, duplicate = add(1)
+	assert.Equal(t, int64(0), lost)
+	assert.False(t, outOfOrder)
+	assert.True(t, duplicate)
+	lost, _, duplicate = add(3 + datagramWindowSize)
+	assert.Equal(t, int64(datagramWindowSize-1), lost)
+	assert.False(t, duplicate)
+	assert.Equal(t, time.Duration(0), tracker.jitter)
+}
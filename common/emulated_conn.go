@@ -0,0 +1,363 @@
+package common
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// receivedPacketsBufferSize is the number of delivered packets that are buffered until they are read
+const receivedPacketsBufferSize = 1024
+
+// EmulatedConn impairs the packets of a net.PacketConn to emulate a network link on loopback.
+// Packets are impaired when they are sent and when they are received, so a single emulated endpoint emulates both directions.
+// Sent packets are written asynchronously, errors of the underlying connection are ignored.
+type EmulatedConn struct {
+	net.PacketConn
+	send    *emulatedLink
+	receive *emulatedLink
+	// delivered by the receive link
+	received chan emulatedPacket
+	// closed if the underlying connection fails to read
+	readErrChan chan struct{}
+	readErr     error
+	closeOnce   sync.Once
+	closed      chan struct{}
+
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+	// closed and replaced whenever the read deadline changes
+	readDeadlineChanged chan struct{}
+}
+
+var _ net.PacketConn = &EmulatedConn{}
+
+type emulatedPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// NewEmulatedConn wraps conn and starts reading from it.
+// Closing the EmulatedConn closes conn.
+func NewEmulatedConn(conn net.PacketConn, config *EmulationConfig) *EmulatedConn {
+	config = config.Populate()
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	c := &EmulatedConn{
+		PacketConn:          conn,
+		received:            make(chan emulatedPacket, receivedPacketsBufferSize),
+		readErrChan:         make(chan struct{}),
+		closed:              make(chan struct{}),
+		readDeadlineChanged: make(chan struct{}),
+	}
+	c.send = newEmulatedLink(config, seed, func(packet emulatedPacket) {
+		_, _ = c.PacketConn.WriteTo(packet.data, packet.addr)
+	})
+	c.send.drainOnClose = true
+	c.receive = newEmulatedLink(config, seed+1, func(packet emulatedPacket) {
+		select {
+		case c.received <- packet:
+		default:
+			// dropped like by a full socket buffer
+		}
+	})
+	go c.runReadLoop()
+	return c
+}
+
+func (c *EmulatedConn) runReadLoop() {
+	// the link copies the packets that are not lost
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			c.readErr = err
+			close(c.readErrChan)
+			return
+		}
+		c.receive.send(emulatedPacket{data: buf[:n], addr: addr})
+	}
+}
+
+func (c *EmulatedConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		c.deadlineMutex.Lock()
+		deadline := c.readDeadline
+		deadlineChanged := c.readDeadlineChanged
+		c.deadlineMutex.Unlock()
+		select {
+		case <-c.closed:
+			return 0, nil, net.ErrClosed
+		default:
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		n, addr, ok, err := c.readUntil(p, deadline, deadlineChanged)
+		if ok {
+			return n, addr, err
+		}
+	}
+}
+
+// readUntil returns ok false if the deadline changed before a packet was received
+func (c *EmulatedConn) readUntil(p []byte, deadline time.Time, deadlineChanged <-chan struct{}) (int, net.Addr, bool, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case packet := <-c.received:
+		return copy(p, packet.data), packet.addr, true, nil
+	case <-c.closed:
+		return 0, nil, true, net.ErrClosed
+	case <-c.readErrChan:
+		return 0, nil, true, c.readErr
+	case <-timeout:
+		return 0, nil, true, os.ErrDeadlineExceeded
+	case <-deadlineChanged:
+		return 0, nil, false, nil
+	}
+}
+
+func (c *EmulatedConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.send.send(emulatedPacket{data: p, addr: addr})
+	return len(p), nil
+}
+
+// Close returns immediately, the underlying connection is closed after the sent packets left the link,
+// e.g. to deliver a CONNECTION_CLOSE frame.
+func (c *EmulatedConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.receive.close(nil)
+		c.send.close(func() {
+			_ = c.PacketConn.Close()
+		})
+		err = nil
+	})
+	return err
+}
+
+func (c *EmulatedConn) SetDeadline(t time.Time) error {
+	err := c.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline does not affect the underlying connection, which is read continuously
+func (c *EmulatedConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	c.readDeadline = t
+	close(c.readDeadlineChanged)
+	c.readDeadlineChanged = make(chan struct{})
+	return nil
+}
+
+// emulatedLink impairs the packets of one direction.
+// Packets are delivered in the order of their delivery time by a single goroutine.
+type emulatedLink struct {
+	config  *EmulationConfig
+	deliver func(packet emulatedPacket)
+	// notifies the delivery loop about a new packet
+	wakeup chan struct{}
+	closed chan struct{}
+	// deliver the packets on the link after close, instead of dropping them
+	drainOnClose bool
+	// called when the delivery loop stopped after close
+	onClosed func()
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	// state of the Gilbert-Elliott model
+	bad bool
+	// the time at which the rate limited link finished transmitting the previous packet
+	busyUntil time.Time
+	// packets on the link
+	queue          scheduledPackets
+	sequenceNumber uint64
+}
+
+func newEmulatedLink(config *EmulationConfig, seed uint64, deliver func(packet emulatedPacket)) *emulatedLink {
+	l := &emulatedLink{
+		config:  config,
+		deliver: deliver,
+		wakeup:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		rand:    rand.New(rand.NewPCG(seed, seed)),
+	}
+	go l.runDeliveryLoop()
+	return l
+}
+
+// send copies the data of the packet, the caller may reuse the buffer
+func (l *emulatedLink) send(packet emulatedPacket) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.lost() {
+		return
+	}
+	// duplicates share the copy, it is not modified on the link
+	packet.data = append([]byte(nil), packet.data...)
+	copies := 1
+	if l.config.Duplicate != 0 && l.rand.Float64() < l.config.Duplicate {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		if l.queue.Len() >= l.config.Limit {
+			return
+		}
+		heap.Push(&l.queue, &scheduledPacket{
+			packet:         packet,
+			deliveryTime:   l.deliveryTime(len(packet.data)),
+			sequenceNumber: l.sequenceNumber,
+		})
+		l.sequenceNumber++
+	}
+	select {
+	case l.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// lost decides whether the next packet is lost, must only be called while holding the lock
+func (l *emulatedLink) lost() bool {
+	if l.config.Loss != 0 && l.rand.Float64() < l.config.Loss {
+		return true
+	}
+	ge := l.config.GilbertElliott
+	if ge == nil {
+		return false
+	}
+	if l.bad {
+		if l.rand.Float64() < ge.R {
+			l.bad = false
+		}
+	} else {
+		if l.rand.Float64() < ge.P {
+			l.bad = true
+		}
+	}
+	lossProbability := ge.LossGood
+	if l.bad {
+		lossProbability = ge.LossBad
+	}
+	return lossProbability != 0 && l.rand.Float64() < lossProbability
+}
+
+// deliveryTime must only be called while holding the lock.
+// Jitter and reordering let packets overtake each other.
+func (l *emulatedLink) deliveryTime(size int) time.Time {
+	now := time.Now()
+	transmitted := now
+	if l.config.Rate != 0 {
+		transmitted = MaxTime([]time.Time{now, l.busyUntil}).Add(time.Duration(float64(size) * 8 / float64(l.config.Rate) * float64(time.Second)))
+		l.busyUntil = transmitted
+	}
+	if l.config.Reorder != 0 && l.rand.Float64() < l.config.Reorder {
+		return transmitted
+	}
+	delay := l.config.Delay
+	if l.config.Jitter != 0 {
+		delay += time.Duration((l.rand.Float64()*2 - 1) * float64(l.config.Jitter))
+	}
+	return transmitted.Add(Max(delay, 0))
+}
+
+func (l *emulatedLink) runDeliveryLoop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	closed := l.closed
+	draining := false
+loop:
+	for {
+		var due []emulatedPacket
+		var next time.Time
+		now := time.Now()
+		l.mutex.Lock()
+		for l.queue.Len() > 0 && !l.queue[0].deliveryTime.After(now) {
+			due = append(due, heap.Pop(&l.queue).(*scheduledPacket).packet)
+		}
+		if l.queue.Len() > 0 {
+			next = l.queue[0].deliveryTime
+		}
+		l.mutex.Unlock()
+		for _, packet := range due {
+			l.deliver(packet)
+		}
+		if draining && next.IsZero() {
+			break
+		}
+		var timeout <-chan time.Time
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-l.wakeup:
+		case <-closed:
+			if !l.drainOnClose {
+				break loop
+			}
+			draining = true
+			closed = nil
+		}
+	}
+	if l.onClosed != nil {
+		l.onClosed()
+	}
+}
+
+// close stops the delivery loop, which calls onClosed.
+// The packets on the link are dropped, unless drainOnClose is set.
+func (l *emulatedLink) close(onClosed func()) {
+	l.onClosed = onClosed
+	close(l.closed)
+}
+
+type scheduledPacket struct {
+	packet       emulatedPacket
+	deliveryTime time.Time
+	// keeps the order of packets with the same delivery time
+	sequenceNumber uint64
+}
+
+// scheduledPackets is a heap ordered by delivery time
+type scheduledPackets []*scheduledPacket
+
+func (q scheduledPackets) Len() int { return len(q) }
+func (q scheduledPackets) Less(i, j int) bool {
+	if q[i].deliveryTime.Equal(q[j].deliveryTime) {
+		return q[i].sequenceNumber < q[j].sequenceNumber
+	}
+	return q[i].deliveryTime.Before(q[j].deliveryTime)
+}
+func (q scheduledPackets) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *scheduledPackets) Push(x any) {
+	*q = append(*q, x.(*scheduledPacket))
+}
+func (q *scheduledPackets) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseEmulationConfig(t *testing.T) {
+	c, err := ParseEmulationConfig("delay=20ms, jitter=2ms,loss=1%,gemodel=1/20,reorder=0.5,duplicate=2%,rate=50Mbit,limit=100,seed=7")
+	require.NoError(t, err)
+	assert.Equal(t, &EmulationConfig{
+		Delay:          20 * time.Millisecond,
+		Jitter:         2 * time.Millisecond,
+		Loss:           0.01,
+		GilbertElliott: &GilbertElliottConfig{P: 0.01, R: 0.2, LossBad: 1},
+		Reorder:        0.005,
+		Duplicate:      0.02,
+		Rate:           50_000_000,
+		Limit:          100,
+		Seed:           7,
+	}, c)
+	parsed, err := ParseEmulationConfig(c.String())
+	require.NoError(t, err)
+	assert.Equal(t, c, parsed)
+
+	for _, s := range []string{"delay", "delay=-1ms", "loss=101%", "gemodel=1", "limit=0", "bandwidth=1Mbit"} {
+		_, err := ParseEmulationConfig(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func newEmulatedConnPair(t *testing.T, config *EmulationConfig) (*EmulatedConn, net.PacketConn) {
+	sender, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = receiver.Close()
+	})
+	conn := NewEmulatedConn(sender, config)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn, receiver
+}
+
+func TestEmulatedConnDelay(t *testing.T) {
+	conn, receiver := newEmulatedConnPair(t, &EmulationConfig{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	for i := byte(0); i < 10; i++ {
+		_, err := conn.WriteTo([]byte{i}, receiver.LocalAddr())
+		require.NoError(t, err)
+	}
+	buf := make([]byte, 10)
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(time.Second)))
+	for i := byte(0); i < 10; i++ {
+		n, _, err := receiver.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{i}, buf[:n])
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestEmulatedConnLoss(t *testing.T) {
+	conn, receiver := newEmulatedConnPair(t, &EmulationConfig{Loss: 1})
+	_, err := conn.WriteTo([]byte{1}, receiver.LocalAddr())
+	require.NoError(t, err)
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = receiver.ReadFrom(make([]byte, 10))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestEmulatedConnReadDeadline(t *testing.T) {
+	conn, _ := newEmulatedConnPair(t, &EmulationConfig{})
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, _, err := conn.ReadFrom(make([]byte, 10))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, conn.Close())
+	_, _, err = conn.ReadFrom(make([]byte, 10))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestEmulatedConnRate(t *testing.T) {
+	// 10 packets of 1000 bytes take 80ms at 1 Mbit/s
+	conn, receiver := newEmulatedConnPair(t, &EmulationConfig{Rate: 1_000_000})
+	start := time.Now()
+	for i := byte(0); i < 10; i++ {
+		_, err := conn.WriteTo(append([]byte{i}, make([]byte, 999)...), receiver.LocalAddr())
+		require.NoError(t, err)
+	}
+	buf := make([]byte, 2000)
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(time.Second)))
+	for i := byte(0); i < 10; i++ {
+		n, _, err := receiver.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, 1000, n)
+		assert.Equal(t, i, buf[0])
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+}
+
+func TestEmulatedConnDuplicate(t *testing.T) {
+	conn, receiver := newEmulatedConnPair(t, &EmulationConfig{Duplicate: 1})
+	buf := []byte{1}
+	_, err := conn.WriteTo(buf, receiver.LocalAddr())
+	require.NoError(t, err)
+	// the sent packet is copied
+	buf[0] = 2
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(time.Second)))
+	for i := 0; i < 2; i++ {
+		n, _, err := receiver.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1}, buf[:n])
+	}
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = receiver.ReadFrom(buf)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestEmulatedConnReceive(t *testing.T) {
+	// received packets are impaired as well and must not share the read buffer
+	conn, sender := newEmulatedConnPair(t, &EmulationConfig{Duplicate: 1, Delay: 20 * time.Millisecond})
+	for i := byte(0); i < 3; i++ {
+		_, err := sender.WriteTo([]byte{i}, conn.LocalAddr())
+		require.NoError(t, err)
+	}
+	buf := make([]byte, 10)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for i := byte(0); i < 6; i++ {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{i / 2}, buf[:n])
+	}
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEmulationLimit is the default maximum number of packets on an emulated link per direction, as in netem
+const DefaultEmulationLimit = 1000
+
+// EmulationConfig describes the impairments of an emulated link, see NewEmulatedConn.
+// Every direction of the link is impaired independently with the same parameters.
+// Probabilities are between 0 and 1.
+type EmulationConfig struct {
+	// Delay is the one-way delay of every packet
+	Delay time.Duration
+	// Jitter is added to or subtracted from the delay, uniformly distributed
+	Jitter time.Duration
+	// Loss is the probability of a random packet loss
+	Loss float64
+	// GilbertElliott enables burst losses in addition to random losses, nil if disabled
+	GilbertElliott *GilbertElliottConfig
+	// Reorder is the probability that a packet is sent without delay, overtaking the delayed packets
+	Reorder float64
+	// Duplicate is the probability that a packet is sent twice
+	Duplicate float64
+	// Rate limits the bandwidth in bits per second, 0 means unlimited
+	Rate uint64
+	// Limit is the maximum number of packets on the link, further packets are dropped.
+	// 0 means DefaultEmulationLimit.
+	Limit int
+	// Seed of the random number generator, 0 means random
+	Seed uint64
+}
+
+// GilbertElliottConfig is the two-state Markov model of burst losses, as in netem
+type GilbertElliottConfig struct {
+	// P is the probability to move from the good to the bad state
+	P float64
+	// R is the probability to move from the bad to the good state
+	R float64
+	// LossBad is the loss probability in the bad state (1-h)
+	LossBad float64
+	// LossGood is the loss probability in the good state (1-k)
+	LossGood float64
+}
+
+func (c *EmulationConfig) Populate() *EmulationConfig {
+	if c == nil {
+		c = &EmulationConfig{}
+	}
+	if c.Limit == 0 {
+		c.Limit = DefaultEmulationLimit
+	}
+	return c
+}
+
+// ParseEmulationConfig parses a comma separated list of impairments, e.g. "delay=20ms,loss=1%,rate=50Mbit".
+// Supported keys are delay and jitter as durations; loss, reorder and duplicate as percentages;
+// gemodel=p/r[/1-h/1-k] as percentages for burst losses, 1-h defaults to 100% and 1-k to 0%;
+// rate as bitrate, see ParseBitrateWithUnit; limit as number of packets; seed as number.
+func ParseEmulationConfig(s string) (*EmulationConfig, error) {
+	c := &EmulationConfig{}
+	for _, option := range strings.Split(s, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value: %s", option)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "delay":
+			c.Delay, err = parseNonNegativeDuration(value)
+		case "jitter":
+			c.Jitter, err = parseNonNegativeDuration(value)
+		case "loss":
+			c.Loss, err = parsePercentage(value)
+		case "gemodel":
+			c.GilbertElliott, err = parseGilbertElliott(value)
+		case "reorder":
+			c.Reorder, err = parsePercentage(value)
+		case "duplicate":
+			c.Duplicate, err = parsePercentage(value)
+		case "rate":
+			c.Rate, err = ParseBitrateWithUnit(value)
+		case "limit":
+			c.Limit, err = strconv.Atoi(value)
+			if err == nil && c.Limit < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "seed":
+			c.Seed, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return nil, fmt.Errorf("unknown key %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", key, err)
+		}
+	}
+	return c, nil
+}
+
+// String returns the config in the format of ParseEmulationConfig, without default values
+func (c *EmulationConfig) String() string {
+	var options []string
+	if c.Delay != 0 {
+		options = append(options, "delay="+c.Delay.String())
+	}
+	if c.Jitter != 0 {
+		options = append(options, "jitter="+c.Jitter.String())
+	}
+	if c.Loss != 0 {
+		options = append(options, "loss="+formatPercentage(c.Loss))
+	}
+	if ge := c.GilbertElliott; ge != nil {
+		options = append(options, fmt.Sprintf("gemodel=%s/%s/%s/%s", formatPercentage(ge.P), formatPercentage(ge.R), formatPercentage(ge.LossBad), formatPercentage(ge.LossGood)))
+	}
+	if c.Reorder != 0 {
+		options = append(options, "reorder="+formatPercentage(c.Reorder))
+	}
+	if c.Duplicate != 0 {
+		options = append(options, "duplicate="+formatPercentage(c.Duplicate))
+	}
+	if c.Rate != 0 {
+		options = append(options, fmt.Sprintf("rate=%dbit", c.Rate))
+	}
+	if c.Limit != 0 && c.Limit != DefaultEmulationLimit {
+		options = append(options, fmt.Sprintf("limit=%d", c.Limit))
+	}
+	if c.Seed != 0 {
+		options = append(options, fmt.Sprintf("seed=%d", c.Seed))
+	}
+	return strings.Join(options, ",")
+}
+
+func parseNonNegativeDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
+
+// parsePercentage returns the probability of a percentage like 1% or 0.5, the percent sign is optional
+func parsePercentage(s string) (float64, error) {
+	percentage, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percentage < 0 || percentage > 100 {
+		return 0, errors.New("must be between 0% and 100%")
+	}
+	return percentage / 100, nil
+}
+
+func formatPercentage(p float64) string {
+	return strconv.FormatFloat(p*100, 'f', -1, 64) + "%"
+}
+
+func parseGilbertElliott(s string) (*GilbertElliottConfig, error) {
+	fields := strings.Split(s, "/")
+	if len(fields) != 2 && len(fields) != 4 {
+		return nil, errors.New("expected p/r or p/r/1-h/1-k")
+	}
+	probabilities := []float64{0, 0, 1, 0}
+	for i, field := range fields {
+		var err error
+		probabilities[i], err = parsePercentage(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &GilbertElliottConfig{
+		P:        probabilities[0],
+		R:        probabilities[1],
+		LossBad:  probabilities[2],
+		LossGood: probabilities[3],
+	}, nil
+}
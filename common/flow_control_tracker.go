@@ -0,0 +1,95 @@
+package common
+
+import (
+	"github.com/quic-go/quic-go/logging"
+	"sync"
+	"time"
+)
+
+// flowControlTracker follows the flow control limits of the data sent in one direction of a connection.
+// The sender is blocked when it announces DATA_BLOCKED or STREAM_DATA_BLOCKED,
+// until the receiver increases the limit by MAX_DATA or MAX_STREAM_DATA.
+type flowControlTracker struct {
+	mutex             sync.Mutex
+	connectionBlocked bool
+	// limit at which the connection is blocked
+	connectionLimit logging.ByteCount
+	// limits at which the streams are blocked
+	streamLimits map[logging.StreamID]logging.ByteCount
+}
+
+func newFlowControlTracker() *flowControlTracker {
+	return &flowControlTracker{
+		streamLimits: map[logging.StreamID]logging.ByteCount{},
+	}
+}
+
+func (t *flowControlTracker) blocked() bool {
+	return t.connectionBlocked || len(t.streamLimits) != 0
+}
+
+// connectionBlockedAt returns true if the connection was not blocked before
+func (t *flowControlTracker) connectionBlockedAt(limit logging.ByteCount) (newlyBlocked bool) {
+	newlyBlocked = !t.connectionBlocked
+	t.connectionBlocked = true
+	t.connectionLimit = limit
+	return newlyBlocked
+}
+
+// streamBlockedAt returns true if the stream was not blocked before
+func (t *flowControlTracker) streamBlockedAt(streamID logging.StreamID, limit logging.ByteCount) (newlyBlocked bool) {
+	_, wasBlocked := t.streamLimits[streamID]
+	t.streamLimits[streamID] = limit
+	return !wasBlocked
+}
+
+func (t *flowControlTracker) maxData(limit logging.ByteCount) {
+	if t.connectionBlocked && limit > t.connectionLimit {
+		t.connectionBlocked = false
+	}
+}
+
+func (t *flowControlTracker) maxStreamData(streamID logging.StreamID, limit logging.ByteCount) {
+	if blockedLimit, ok := t.streamLimits[streamID]; ok && limit > blockedLimit {
+		delete(t.streamLimits, streamID)
+	}
+}
+
+// blockedTimer accumulates the time during which at least one sender is blocked
+type blockedTimer struct {
+	// number of blocked connections
+	blocked int
+	// time until which the blocked time is accounted
+	checkpoint    time.Time
+	intervalTotal time.Duration
+	total         time.Duration
+}
+
+func (t *blockedTimer) account(now time.Time) {
+	if t.blocked != 0 {
+		t.intervalTotal += now.Sub(t.checkpoint)
+		t.total += now.Sub(t.checkpoint)
+	}
+	t.checkpoint = now
+}
+
+func (t *blockedTimer) set(blocked bool, now time.Time) {
+	t.account(now)
+	if blocked {
+		t.blocked++
+	} else {
+		t.blocked--
+	}
+}
+
+func (t *blockedTimer) getAndResetInterval(now time.Time) time.Duration {
+	t.account(now)
+	interval := t.intervalTotal
+	t.intervalTotal = 0
+	return interval
+}
+
+func (t *blockedTimer) getTotal(now time.Time) time.Duration {
+	t.account(now)
+	return t.total
+}
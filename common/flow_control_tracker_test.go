@@ -0,0 +1,32 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFlowControlTracker(t *testing.T) {
+	tracker := newFlowControlTracker()
+	assert.True(t, tracker.connectionBlockedAt(100))
+	assert.False(t, tracker.connectionBlockedAt(100))
+	assert.True(t, tracker.streamBlockedAt(4, 50))
+	tracker.maxData(100)
+	assert.True(t, tracker.blocked())
+	tracker.maxData(200)
+	assert.True(t, tracker.blocked())
+	tracker.maxStreamData(4, 60)
+	assert.False(t, tracker.blocked())
+}
+
+func TestBlockedTimer(t *testing.T) {
+	var timer blockedTimer
+	start := time.Now()
+	timer.set(true, start)
+	timer.set(true, start.Add(time.Second))
+	timer.set(false, start.Add(2*time.Second))
+	assert.Equal(t, 3*time.Second, timer.getAndResetInterval(start.Add(3*time.Second)))
+	timer.set(false, start.Add(4*time.Second))
+	assert.Equal(t, time.Second, timer.getAndResetInterval(start.Add(5*time.Second)))
+	assert.Equal(t, 4*time.Second, timer.getTotal(start.Add(6*time.Second)))
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"github.com/francoispqt/gojay"
+	"math/bits"
+	"time"
+)
+
+// histogramSubBucketBits determines the precision of the histogram,
+// every power of two range is divided into 2^histogramSubBucketBits linear buckets,
+// i.e. the relative error is below 1%.
+const histogramSubBucketBits = 7
+
+const histogramSubBucketCount = 1 << histogramSubBucketBits
+
+// Histogram records durations in log-linear buckets, similar to an HDR histogram.
+// Not safe for concurrent use.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	max    time.Duration
+}
+
+// histogramBucketIndex returns the index of the bucket containing v
+func histogramBucketIndex(v uint64) int {
+	if v < histogramSubBucketCount {
+		return int(v)
+	}
+	// shift v such that only the histogramSubBucketBits+1 most significant bits remain
+	shift := bits.Len64(v) - histogramSubBucketBits - 1
+	return (shift+1)*histogramSubBucketCount + int(v>>shift) - histogramSubBucketCount
+}
+
+// histogramBucketUpperBound returns the highest value that belongs to the bucket
+func histogramBucketUpperBound(index int) uint64 {
+	if index < histogramSubBucketCount {
+		return uint64(index)
+	}
+	shift := index/histogramSubBucketCount - 1
+	subBucket := uint64(index%histogramSubBucketCount + histogramSubBucketCount)
+	return (subBucket+1)<<shift - 1
+}
+
+// Record adds a sample, negative durations are recorded as 0
+func (h *Histogram) Record(d time.Duration) {
+	d = Max(d, 0)
+	index := histogramBucketIndex(uint64(d))
+	if index >= len(h.counts) {
+		counts := make([]uint64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+	h.count++
+	h.max = Max(h.max, d)
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Percentile returns the value below or equal to which the given percentage of samples fall,
+// e.g. 99.9 for the 99.9th percentile.
+// Returns 0 if there are no samples.
+func (h *Histogram) Percentile(percentile float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	// rank of the sample, starting at 1
+	rank := uint64(percentile / 100 * float64(h.count))
+	if float64(rank) < percentile/100*float64(h.count) {
+		rank++
+	}
+	rank = Max(rank, 1)
+	var cumulative uint64
+	for index, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			return Min(time.Duration(histogramBucketUpperBound(index)), h.max)
+		}
+	}
+	return h.max
+}
+
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+// Summary returns the common percentiles
+func (h *Histogram) Summary() LatencySummary {
+	return LatencySummary{
+		Count: h.count,
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P99:   h.Percentile(99),
+		P999:  h.Percentile(99.9),
+		Max:   h.max,
+	}
+}
+
+// LatencySummary contains the percentiles of a Histogram
+type LatencySummary struct {
+	Count uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+	Max   time.Duration
+}
+
+func (s LatencySummary) IsNil() bool { return false }
+func (s LatencySummary) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Uint64Key("count", s.Count)
+	enc.Float32Key("p50", float32(s.P50.Seconds()*1000))
+	enc.Float32Key("p90", float32(s.P90.Seconds()*1000))
+	enc.Float32Key("p99", float32(s.P99.Seconds()*1000))
+	enc.Float32Key("p99.9", float32(s.P999.Seconds()*1000))
+	enc.Float32Key("max", float32(s.Max.Seconds()*1000))
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 129, 255, 256, 257, 1000, 123456789, 1 << 40} {
+		index := histogramBucketIndex(v)
+		assert.GreaterOrEqual(t, histogramBucketUpperBound(index), v)
+		if index > 0 {
+			assert.Less(t, histogramBucketUpperBound(index-1), v)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var h Histogram
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1000), h.Count())
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(h.Percentile(50)), 0.01)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(h.Percentile(99)), 0.01)
+	assert.Equal(t, time.Second, h.Percentile(100))
+	assert.Equal(t, time.Second, h.Max())
+	h.Reset()
+	assert.Equal(t, uint64(0), h.Count())
+}
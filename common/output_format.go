@@ -0,0 +1,59 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"qperf-go/common/qlog"
+)
+
+// OutputFormat selects how events are printed to stdout
+type OutputFormat int
+
+const (
+	// OutputFormatQlog prints a qlog trace header followed by newline-delimited JSON events
+	OutputFormatQlog OutputFormat = iota
+	// OutputFormatText prints reports as a human-readable table
+	OutputFormatText
+	// OutputFormatJSON prints newline-delimited JSON events without the qlog trace header
+	OutputFormatJSON
+)
+
+func (f OutputFormat) String() string {
+	switch f {
+	case OutputFormatQlog:
+		return "qlog"
+	case OutputFormatText:
+		return "text"
+	case OutputFormatJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("OutputFormat(%d)", int(f))
+	}
+}
+
+// ParseOutputFormat supports qlog, text and json
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch s {
+	case "qlog":
+		return OutputFormatQlog, nil
+	case "text":
+		return OutputFormatText, nil
+	case "json":
+		return OutputFormatJSON, nil
+	default:
+		return 0, fmt.Errorf("unknown output format %q, expected qlog, text or json", s)
+	}
+}
+
+// NewStdoutWriter writes all events to stdout in the given format.
+// printRaw only applies to OutputFormatText.
+func NewStdoutWriter(format OutputFormat, printRaw bool, config *qlog.Config) qlog.Writer {
+	switch format {
+	case OutputFormatText:
+		return NewTextWriter(os.Stdout, printRaw, config)
+	case OutputFormatJSON:
+		return qlog.NewStdoutEventWriter(config)
+	default:
+		return qlog.NewStdoutQlogWriter(config)
+	}
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// PersistentSessionCache keeps TLS session tickets in a file, to resume sessions across processes.
+// Every line of the file contains the cache key, the ticket and the session state, base64 encoded and separated by tabs.
+// The file is rewritten on every change.
+type PersistentSessionCache struct {
+	mutex    sync.Mutex
+	filepath string
+	sessions map[string]*tls.ClientSessionState
+}
+
+var _ tls.ClientSessionCache = (*PersistentSessionCache)(nil)
+
+// NewPersistentSessionCache loads the sessions of the file, if it exists
+func NewPersistentSessionCache(filepath string) (*PersistentSessionCache, error) {
+	c := &PersistentSessionCache{
+		filepath: filepath,
+		sessions: map[string]*tls.ClientSessionState{},
+	}
+	err := readPersistentEntries(filepath, 3, func(fields [][]byte) error {
+		state, err := tls.ParseSessionState(fields[2])
+		if err != nil {
+			return err
+		}
+		session, err := tls.NewResumptionState(fields[1], state)
+		if err != nil {
+			return err
+		}
+		c.sessions[string(fields[0])] = session
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *PersistentSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	session, ok := c.sessions[sessionKey]
+	return session, ok
+}
+
+// Put stores the session and writes the file, a nil session removes the key.
+// Errors are ignored, as they cannot be returned to crypto/tls.
+func (c *PersistentSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cs == nil {
+		delete(c.sessions, sessionKey)
+	} else {
+		c.sessions[sessionKey] = cs
+	}
+	_ = c.write()
+}
+
+// Len returns the number of stored sessions
+func (c *PersistentSessionCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.sessions)
+}
+
+// must only be called while holding the lock
+func (c *PersistentSessionCache) write() error {
+	var entries [][][]byte
+	for key, session := range c.sessions {
+		ticket, state, err := session.ResumptionState()
+		if err != nil || state == nil {
+			continue
+		}
+		stateBytes, err := state.Bytes()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, [][]byte{[]byte(key), ticket, stateBytes})
+	}
+	return writePersistentEntries(c.filepath, entries)
+}
+
+// readPersistentEntries calls handle for every line of the file, with the base64 decoded fields of the line.
+// A missing file is treated as empty.
+func readPersistentEntries(filepath string, numFields int, handle func(fields [][]byte) error) error {
+	f, err := os.Open(filepath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		encodedFields := strings.Split(line, "\t")
+		if len(encodedFields) != numFields {
+			return fmt.Errorf("%s:%d: expected %d fields", filepath, lineNumber, numFields)
+		}
+		fields := make([][]byte, numFields)
+		for i, encodedField := range encodedFields {
+			fields[i], err = base64.StdEncoding.DecodeString(encodedField)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", filepath, lineNumber, err)
+			}
+		}
+		err = handle(fields)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filepath, lineNumber, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// writePersistentEntries replaces the file atomically, every entry is written as a line of base64 encoded fields
+func writePersistentEntries(filepath string, entries [][][]byte) error {
+	err := os.MkdirAll(path.Dir(filepath), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(path.Dir(filepath), path.Base(filepath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, fields := range entries {
+		encodedFields := make([]string, len(fields))
+		for i, field := range fields {
+			encodedFields[i] = base64.StdEncoding.EncodeToString(field)
+		}
+		_, _ = w.WriteString(strings.Join(encodedFields, "\t") + "\n")
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath)
+}
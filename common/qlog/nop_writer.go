@@ -0,0 +1,34 @@
+package qlog
+
+import "time"
+
+type nopWriter struct {
+	referenceTime time.Time
+	config        *Config
+}
+
+// NewNopWriter drops all events
+func NewNopWriter(config *Config) Writer {
+	return &nopWriter{
+		referenceTime: time.Now(),
+		config:        config.Populate(),
+	}
+}
+
+func (w *nopWriter) RecordEvent(EventDetails)                                              {}
+func (w *nopWriter) RecordEventAtTime(time.Time, EventDetails)                             {}
+func (w *nopWriter) RecordEventAtTimeWithGroup(EventDetails, time.Time, string)            {}
+func (w *nopWriter) RecordEventWithTimeGroupODCID(EventDetails, time.Time, string, string) {}
+func (w *nopWriter) Close()                                                                {}
+
+func (w *nopWriter) ReferenceTime() time.Time {
+	return w.referenceTime
+}
+
+func (w *nopWriter) Includes(category string, name string) bool {
+	return w.config.Included(category, name)
+}
+
+func (w *nopWriter) Config() Config {
+	return *w.config.Copy()
+}
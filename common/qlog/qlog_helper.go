@@ -13,6 +13,11 @@ func NewStdoutQlogWriter(config *Config) Writer {
 	return NewQlogWriter(&NotClosingWriteCloser{os.Stdout}, config)
 }
 
+// NewStdoutEventWriter writes all events to stdout as newline-delimited JSON, without the qlog trace header
+func NewStdoutEventWriter(config *Config) Writer {
+	return NewEventWriter(&NotClosingWriteCloser{os.Stdout}, config)
+}
+
 // NewFileQlogWriter writes everything to a single file
 func NewFileQlogWriter(filepath string, config *Config) Writer {
 	err := os.MkdirAll(path.Dir(filepath), 0700)
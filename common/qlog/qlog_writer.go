@@ -32,6 +32,8 @@ type qlogWriter struct {
 	encodeErr  error
 	runStopped chan struct{}
 	config     *Config
+	// write the qlog trace header before the events
+	header bool
 }
 
 func (w *qlogWriter) Config() Config {
@@ -43,6 +45,15 @@ func (w *qlogWriter) Includes(category string, name string) bool {
 }
 
 func NewQlogWriter(wc io.WriteCloser, config *Config) Writer {
+	return newQlogWriter(wc, config, true)
+}
+
+// NewEventWriter writes the events as newline-delimited JSON, without the qlog trace header.
+func NewEventWriter(wc io.WriteCloser, config *Config) Writer {
+	return newQlogWriter(wc, config, false)
+}
+
+func newQlogWriter(wc io.WriteCloser, config *Config, header bool) Writer {
 	config = config.Populate()
 	w := &qlogWriter{
 		w:             wc,
@@ -50,6 +61,7 @@ func NewQlogWriter(wc io.WriteCloser, config *Config) Writer {
 		events:        make(chan event, config.MemoryQueueSize),
 		referenceTime: time.Now(),
 		config:        config,
+		header:        header,
 	}
 	go w.run()
 	return w
@@ -58,6 +70,27 @@ func NewQlogWriter(wc io.WriteCloser, config *Config) Writer {
 func (w *qlogWriter) run() {
 	defer close(w.runStopped)
 	enc := gojay.NewEncoder(w.w)
+	if w.header {
+		w.writeHeader(enc)
+	}
+	for ev := range w.events {
+		if w.encodeErr != nil { // if encoding failed, just continue draining the event channel
+			continue
+		}
+		if !w.Includes(ev.EventDetails.Category(), ev.EventDetails.Name()) {
+			continue
+		}
+		if err := enc.Encode(ev); err != nil {
+			w.encodeErr = err
+			continue
+		}
+		if _, err := w.w.Write([]byte{'\n'}); err != nil {
+			w.encodeErr = err
+		}
+	}
+}
+
+func (w *qlogWriter) writeHeader(enc *gojay.Encoder) {
 	tl := &topLevel{
 		trace: trace{
 			Title:       w.config.Title,
@@ -78,21 +111,6 @@ func (w *qlogWriter) run() {
 	if _, err := w.w.Write([]byte{'\n'}); err != nil {
 		panic(fmt.Sprintf("qlog encoding failed: %s", err))
 	}
-	for ev := range w.events {
-		if w.encodeErr != nil { // if encoding failed, just continue draining the event channel
-			continue
-		}
-		if !w.Includes(ev.EventDetails.Category(), ev.EventDetails.Name()) {
-			continue
-		}
-		if err := enc.Encode(ev); err != nil {
-			w.encodeErr = err
-			continue
-		}
-		if _, err := w.w.Write([]byte{'\n'}); err != nil {
-			w.encodeErr = err
-		}
-	}
 }
 
 func (w *qlogWriter) Close() {
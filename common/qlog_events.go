@@ -64,6 +64,17 @@ type ReportEvent struct {
 	PacketsReceived                   *uint64
 	MinRTT                            *time.Duration
 	MaxRTT                            *time.Duration
+	SmoothedRTT                       *time.Duration
+	RTTVariance                       *time.Duration
+	LatestRTT                         *time.Duration
+	CongestionWindow                  *ByteCountStats
+	BytesInFlight                     *ByteCountStats
+	FlowControlBlockedSending         *time.Duration
+	FlowControlBlockedReceiving       *time.Duration
+	LimitedBy                         *string
+	RequestLatency                    *LatencySummary
+	RequestLength                     *ByteCountStats
+	ResponseLength                    *ByteCountStats
 	PacketsLost                       *uint64
 	StreamBytesSent                   *logging.ByteCount
 	DatagramBytesReceived             *logging.ByteCount
@@ -73,6 +84,18 @@ type ReportEvent struct {
 	StreamMegaBitsPerSecondSent       *float32
 	DeadlineExceededResponses         *uint64
 	ResponsesReceived                 *uint64
+	DatagramsReceived                 *uint64
+	DatagramsLost                     *uint64
+	DatagramLossPercentage            *float32
+	DatagramsOutOfOrder               *uint64
+	DatagramsDuplicate                *uint64
+	DatagramJitter                    *time.Duration
+	ZeroRTT                           *ZeroRTTStats
+	Verification                      *VerificationStats
+	// breakdown of parallel connections, nil if there is only one
+	Connections []ConnectionReport
+	// breakdown of parallel streams, nil if there is only one per connection
+	Streams []StreamReport
 }
 
 var _ qlog.EventDetails = &ReportEvent{}
@@ -105,6 +128,24 @@ func (t ReportEvent) MarshalJSONObject(enc *gojay.Encoder) {
 	if t.DatagramBytesReceived != nil {
 		enc.Uint64Key("datagram_bytes_received", uint64(*t.DatagramBytesReceived))
 	}
+	if t.DatagramsReceived != nil {
+		enc.Uint64Key("datagrams_received", *t.DatagramsReceived)
+	}
+	if t.DatagramsLost != nil {
+		enc.Uint64Key("datagrams_lost", *t.DatagramsLost)
+	}
+	if t.DatagramLossPercentage != nil {
+		enc.Float32Key("datagram_loss_percentage", *t.DatagramLossPercentage)
+	}
+	if t.DatagramsOutOfOrder != nil {
+		enc.Uint64Key("datagrams_out_of_order", *t.DatagramsOutOfOrder)
+	}
+	if t.DatagramsDuplicate != nil {
+		enc.Uint64Key("datagrams_duplicate", *t.DatagramsDuplicate)
+	}
+	if t.DatagramJitter != nil {
+		enc.Float32Key("datagram_jitter", float32(t.DatagramJitter.Seconds()*1000))
+	}
 	if t.PacketsReceived != nil {
 		enc.Uint64Key("packets_received", *t.PacketsReceived)
 	}
@@ -114,25 +155,353 @@ func (t ReportEvent) MarshalJSONObject(enc *gojay.Encoder) {
 	if t.MaxRTT != nil {
 		enc.Float32Key("max_rtt", float32(t.MaxRTT.Seconds()*1000))
 	}
+	if t.SmoothedRTT != nil {
+		enc.Float32Key("smoothed_rtt", float32(t.SmoothedRTT.Seconds()*1000))
+	}
+	if t.RTTVariance != nil {
+		enc.Float32Key("rtt_variance", float32(t.RTTVariance.Seconds()*1000))
+	}
+	if t.LatestRTT != nil {
+		enc.Float32Key("latest_rtt", float32(t.LatestRTT.Seconds()*1000))
+	}
+	if t.CongestionWindow != nil {
+		enc.ObjectKey("cwnd", t.CongestionWindow)
+	}
+	if t.BytesInFlight != nil {
+		enc.ObjectKey("bytes_in_flight", t.BytesInFlight)
+	}
+	if t.FlowControlBlockedSending != nil {
+		enc.Float32Key("flow_control_blocked_sending", float32(t.FlowControlBlockedSending.Seconds()*1000))
+	}
+	if t.FlowControlBlockedReceiving != nil {
+		enc.Float32Key("flow_control_blocked_receiving", float32(t.FlowControlBlockedReceiving.Seconds()*1000))
+	}
+	if t.LimitedBy != nil {
+		enc.StringKey("limited_by", *t.LimitedBy)
+	}
 	if t.PacketsLost != nil {
 		enc.Uint64Key("packets_lost", *t.PacketsLost)
 	}
 	if t.ResponsesReceived != nil {
 		enc.Uint64KeyOmitEmpty("responses_received", *t.ResponsesReceived)
 	}
+	if t.RequestLatency != nil {
+		enc.ObjectKey("request_latency", t.RequestLatency)
+	}
+	if t.RequestLength != nil {
+		enc.ObjectKey("request_length", t.RequestLength)
+	}
+	if t.ResponseLength != nil {
+		enc.ObjectKey("response_length", t.ResponseLength)
+	}
 	if t.DeadlineExceededResponses != nil {
 		enc.Uint64Key("deadline_exceeded", *t.DeadlineExceededResponses)
 	}
+	if t.ZeroRTT != nil {
+		enc.ObjectKey("zero_rtt", t.ZeroRTT)
+	}
+	if t.Verification != nil {
+		enc.ObjectKey("verification", t.Verification)
+	}
+	if t.Connections != nil {
+		enc.ArrayKey("connections", connectionReports(t.Connections))
+	}
+	if t.Streams != nil {
+		enc.ArrayKey("streams", streamReports(t.Streams))
+	}
 	enc.Float32Key("period", float32(t.Period.Seconds()*1000))
 }
 
+// ConnectionReport is the part of a report that belongs to one of multiple parallel connections
+type ConnectionReport struct {
+	// index of the connection
+	Connection                      int
+	StreamMegaBitsPerSecondReceived *float32
+	StreamBytesReceived             *logging.ByteCount
+	StreamMegaBitsPerSecondSent     *float32
+	StreamBytesSent                 *logging.ByteCount
+}
+
+func (r ConnectionReport) IsNil() bool { return false }
+func (r ConnectionReport) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.IntKey("connection", r.Connection)
+	if r.StreamMegaBitsPerSecondReceived != nil {
+		enc.Float32Key("stream_mbps_received", *r.StreamMegaBitsPerSecondReceived)
+	}
+	if r.StreamMegaBitsPerSecondSent != nil {
+		enc.Float32Key("stream_mbps_sent", *r.StreamMegaBitsPerSecondSent)
+	}
+	if r.StreamBytesReceived != nil {
+		enc.Uint64Key("stream_bytes_received", uint64(*r.StreamBytesReceived))
+	}
+	if r.StreamBytesSent != nil {
+		enc.Uint64Key("stream_bytes_sent", uint64(*r.StreamBytesSent))
+	}
+}
+
+type connectionReports []ConnectionReport
+
+func (r connectionReports) IsNil() bool { return r == nil }
+func (r connectionReports) MarshalJSONArray(enc *gojay.Encoder) {
+	for _, report := range r {
+		enc.Object(report)
+	}
+}
+
+// StreamReport is the part of a report that belongs to one of multiple parallel infinite streams.
+// A stream is identified by the index of the connection and its index within that connection,
+// the receiving and sending stream with the same index are reported together.
+type StreamReport struct {
+	Connection                int
+	Stream                    int
+	MegaBitsPerSecondReceived *float32
+	BytesReceived             *logging.ByteCount
+	MegaBitsPerSecondSent     *float32
+	BytesSent                 *logging.ByteCount
+}
+
+func (r StreamReport) IsNil() bool { return false }
+func (r StreamReport) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.IntKey("connection", r.Connection)
+	enc.IntKey("stream", r.Stream)
+	if r.MegaBitsPerSecondReceived != nil {
+		enc.Float32Key("mbps_received", *r.MegaBitsPerSecondReceived)
+	}
+	if r.MegaBitsPerSecondSent != nil {
+		enc.Float32Key("mbps_sent", *r.MegaBitsPerSecondSent)
+	}
+	if r.BytesReceived != nil {
+		enc.Uint64Key("bytes_received", uint64(*r.BytesReceived))
+	}
+	if r.BytesSent != nil {
+		enc.Uint64Key("bytes_sent", uint64(*r.BytesSent))
+	}
+}
+
+type streamReports []StreamReport
+
+func (r streamReports) IsNil() bool { return r == nil }
+func (r streamReports) MarshalJSONArray(enc *gojay.Encoder) {
+	for _, report := range r {
+		enc.Object(report)
+	}
+}
+
 type TotalEvent struct {
 	ReportEvent
+	// Remote is the view of the peer, nil if not available
+	Remote *ReportEvent
 }
 
 var _ qlog.EventDetails = &TotalEvent{}
 
 func (t TotalEvent) Name() string { return "total" }
+func (t TotalEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	t.ReportEvent.MarshalJSONObject(enc)
+	if t.Remote != nil {
+		enc.ObjectKey("remote", t.Remote)
+	}
+}
+
+// FlowControlBlockedEvent is recorded when a connection or stream becomes blocked by flow control
+type FlowControlBlockedEvent struct {
+	// Owner is local if our data is blocked by the limits of the peer, remote otherwise
+	Owner string
+	// nil if the connection is blocked
+	StreamID *logging.StreamID
+	Limit    logging.ByteCount
+}
+
+var _ qlog.EventDetails = &FlowControlBlockedEvent{}
+
+func (e FlowControlBlockedEvent) Category() string { return "qperf" }
+func (e FlowControlBlockedEvent) Name() string     { return "flow_control_blocked" }
+func (e FlowControlBlockedEvent) IsNil() bool      { return false }
+func (e FlowControlBlockedEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.StringKey("owner", e.Owner)
+	if e.StreamID != nil {
+		enc.StringKey("level", "stream")
+		enc.Int64Key("stream_id", int64(*e.StreamID))
+	} else {
+		enc.StringKey("level", "connection")
+	}
+	enc.Uint64Key("limit", uint64(e.Limit))
+}
+
+// RequestCompletedEvent is recorded when the response of a request is completely received
+type RequestCompletedEvent struct {
+	StreamID logging.StreamID
+	// sampled lengths
+	RequestLength  uint64
+	ResponseLength uint64
+	// transferred bytes
+	RequestBytes  uint64
+	ResponseBytes uint64
+	// from sending the request until the response is completely received
+	Latency time.Duration
+}
+
+var _ qlog.EventDetails = &RequestCompletedEvent{}
+
+func (e RequestCompletedEvent) Category() string { return "qperf" }
+func (e RequestCompletedEvent) Name() string     { return "request_completed" }
+func (e RequestCompletedEvent) IsNil() bool      { return false }
+func (e RequestCompletedEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Int64Key("stream_id", int64(e.StreamID))
+	enc.Uint64Key("request_length", e.RequestLength)
+	enc.Uint64Key("response_length", e.ResponseLength)
+	enc.Uint64Key("request_bytes", e.RequestBytes)
+	enc.Uint64Key("response_bytes", e.ResponseBytes)
+	enc.Float32Key("latency", float32(e.Latency.Seconds()*1000))
+}
+
+const (
+	RequestResultCompleted        = "completed"
+	RequestResultDeadlineExceeded = "deadline_exceeded"
+	RequestResultFailed           = "failed"
+)
+
+// WorkloadEntryFinishedEvent is recorded when the request of a replayed workload entry is finished
+type WorkloadEntryFinishedEvent struct {
+	// index of the entry, after sorting by offset
+	Entry int
+	// scheduled start of the request, relative to the start of the workload
+	Offset time.Duration
+	// one of the RequestResult constants
+	Result string
+	// from the scheduled start until the response is completely received, nil if not completed
+	Latency *time.Duration
+}
+
+var _ qlog.EventDetails = &WorkloadEntryFinishedEvent{}
+
+func (e WorkloadEntryFinishedEvent) Category() string { return "qperf" }
+func (e WorkloadEntryFinishedEvent) Name() string     { return "workload_entry_finished" }
+func (e WorkloadEntryFinishedEvent) IsNil() bool      { return false }
+func (e WorkloadEntryFinishedEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.IntKey("entry", e.Entry)
+	enc.Float32Key("offset", float32(e.Offset.Seconds()*1000))
+	enc.StringKey("result", e.Result)
+	if e.Latency != nil {
+		enc.Float32Key("latency", float32(e.Latency.Seconds()*1000))
+		enc.Float32Key("completion", float32((e.Offset+*e.Latency).Seconds()*1000))
+	}
+}
+
+// TTFBAttemptEvent is recorded for every connection of a repeated time to first byte measurement.
+// Times are relative to the start of the connection, nil if not reached.
+type TTFBAttemptEvent struct {
+	Attempt              int
+	HandshakeCompleted   *time.Duration
+	HandshakeConfirmed   *time.Duration
+	FirstAppDataSent     *time.Duration
+	FirstAppDataReceived *time.Duration
+}
+
+var _ qlog.EventDetails = &TTFBAttemptEvent{}
+
+func (e TTFBAttemptEvent) Category() string { return "qperf" }
+func (e TTFBAttemptEvent) Name() string     { return "ttfb_attempt" }
+func (e TTFBAttemptEvent) IsNil() bool      { return false }
+func (e TTFBAttemptEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.IntKey("attempt", e.Attempt)
+	if e.HandshakeCompleted != nil {
+		enc.Float32Key("handshake_completed", float32(e.HandshakeCompleted.Seconds()*1000))
+	}
+	if e.HandshakeConfirmed != nil {
+		enc.Float32Key("handshake_confirmed", float32(e.HandshakeConfirmed.Seconds()*1000))
+	}
+	if e.FirstAppDataSent != nil {
+		enc.Float32Key("first_app_data_sent", float32(e.FirstAppDataSent.Seconds()*1000))
+	}
+	if e.FirstAppDataReceived != nil {
+		enc.Float32Key("first_app_data_received", float32(e.FirstAppDataReceived.Seconds()*1000))
+	}
+}
+
+// TTFBSeriesEvent summarizes the TTFBAttemptEvent of all connections
+type TTFBSeriesEvent struct {
+	Attempts             int
+	HandshakeCompleted   LatencySummary
+	HandshakeConfirmed   LatencySummary
+	FirstAppDataSent     LatencySummary
+	FirstAppDataReceived LatencySummary
+}
+
+var _ qlog.EventDetails = &TTFBSeriesEvent{}
+
+func (e TTFBSeriesEvent) Category() string { return "qperf" }
+func (e TTFBSeriesEvent) Name() string     { return "ttfb_series" }
+func (e TTFBSeriesEvent) IsNil() bool      { return false }
+func (e TTFBSeriesEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.IntKey("attempts", e.Attempts)
+	enc.ObjectKey("handshake_completed", e.HandshakeCompleted)
+	enc.ObjectKey("handshake_confirmed", e.HandshakeConfirmed)
+	enc.ObjectKey("first_app_data_sent", e.FirstAppDataSent)
+	enc.ObjectKey("first_app_data_received", e.FirstAppDataReceived)
+}
+
+// ZeroRTTEvent is recorded at the end of a test that used or offered 0-RTT
+type ZeroRTTEvent struct {
+	ZeroRTTStats
+}
+
+var _ qlog.EventDetails = &ZeroRTTEvent{}
+
+func (e ZeroRTTEvent) Category() string { return "qperf" }
+func (e ZeroRTTEvent) Name() string     { return "zero_rtt" }
+
+// VerificationFailedEvent is recorded at the first mismatch of a received stream with the expected pattern
+type VerificationFailedEvent struct {
+	StreamID int64
+	// Direction is request or response
+	Direction string
+	// Offset of the first mismatching byte in the stream
+	Offset uint64
+}
+
+var _ qlog.EventDetails = &VerificationFailedEvent{}
+
+func (e VerificationFailedEvent) Category() string { return "qperf" }
+func (e VerificationFailedEvent) Name() string     { return "verification_failed" }
+func (e VerificationFailedEvent) IsNil() bool      { return false }
+func (e VerificationFailedEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Int64Key("stream_id", e.StreamID)
+	enc.StringKey("direction", e.Direction)
+	enc.Uint64Key("offset", e.Offset)
+}
+
+// TestDescriptionEvent is recorded by the server when it accepted the test description of a client
+type TestDescriptionEvent struct {
+	Version      uint64
+	Duration     time.Duration
+	Bitrate      uint64
+	Burst        uint64
+	DatagramSize uint64
+	Direction    string
+}
+
+var _ qlog.EventDetails = &TestDescriptionEvent{}
+
+func (e TestDescriptionEvent) Category() string { return "qperf" }
+func (e TestDescriptionEvent) Name() string     { return "test_description" }
+func (e TestDescriptionEvent) IsNil() bool      { return false }
+func (e TestDescriptionEvent) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Uint64Key("version", e.Version)
+	enc.StringKey("direction", e.Direction)
+	if e.Duration != 0 {
+		enc.Float32Key("duration", float32(e.Duration.Seconds()*1000))
+	}
+	if e.Bitrate != 0 {
+		enc.Uint64Key("bitrate", e.Bitrate)
+	}
+	if e.Burst != 0 {
+		enc.Uint64Key("burst", e.Burst)
+	}
+	if e.DatagramSize != 0 {
+		enc.Uint64Key("datagram_size", e.DatagramSize)
+	}
+}
 
 type EventConnectionStarted struct {
 	DestConnectionID logging.ConnectionID
@@ -6,16 +6,91 @@ import (
 )
 
 type Report struct {
-	ReceivedBytes             logging.ByteCount
-	ReceivedPackets           uint64
-	TimeAggregated            time.Duration
-	MinRTT                    time.Duration
-	MaxRTT                    time.Duration
-	SmoothedRTT               time.Duration
+	ReceivedBytes   logging.ByteCount
+	ReceivedPackets uint64
+	TimeAggregated  time.Duration
+	// MinRTT and MaxRTT are only valid if HasRTT returns true, they are taken over all connections
+	MinRTT time.Duration
+	MaxRTT time.Duration
+	// SmoothedRTT, RTTVariance and LatestRTT are averaged over the connections
+	SmoothedRTT time.Duration
+	// mean deviation of the RTT samples, as calculated by quic-go
+	RTTVariance               time.Duration
+	LatestRTT                 time.Duration
 	PacketsLost               uint64
 	SentBytes                 logging.ByteCount
 	ReceivedDatagramBytes     logging.ByteCount
 	SentDatagramBytes         logging.ByteCount
 	ReceivedResponses         uint64
 	DeadlineExceededResponses uint64
+	// number of received payload datagrams, including duplicates
+	ReceivedDatagrams   uint64
+	LostDatagrams       uint64
+	OutOfOrderDatagrams uint64
+	DuplicateDatagrams  uint64
+	// interarrival jitter as specified in RFC 3550, averaged over all flows
+	DatagramJitter time.Duration
+	// samples of the sums over all connections, Samples is 0 if there was no update
+	CongestionWindow ByteCountStats
+	BytesInFlight    ByteCountStats
+	// time during which our data was blocked by the flow control limits of the peer, averaged over the connections
+	FlowControlBlockedSending time.Duration
+	// time during which the data of the peer was blocked by our flow control limits, averaged over the connections
+	FlowControlBlockedReceiving time.Duration
+	// of successful requests
+	RequestLatency LatencySummary
+	// sampled lengths of the started requests and their responses
+	RequestLength  ByteCountStats
+	ResponseLength ByteCountStats
+	// only set for the total report
+	ZeroRTT ZeroRTTStats
+	// only set for the total report
+	Verification VerificationStats
+}
+
+const (
+	// LimitedBySendFlowControl means the receive window of the peer limited the data we sent
+	LimitedBySendFlowControl = "send_flow_control"
+	// LimitedByReceiveFlowControl means our receive window limited the data the peer sent
+	LimitedByReceiveFlowControl = "receive_flow_control"
+	LimitedByCongestionControl  = "congestion_control"
+	// LimitedByApplication means the sender did not provide enough data, e.g. because of a bitrate limit
+	LimitedByApplication = "application"
+)
+
+// LimitedBy classifies what most likely limited the throughput during the aggregated time.
+// sending is true if we sent data, because congestion control is only observed for our own data.
+// Returns an empty string if unknown.
+func (r Report) LimitedBy(sending bool) string {
+	if r.TimeAggregated <= 0 {
+		return ""
+	}
+	if r.FlowControlBlockedReceiving*2 >= r.TimeAggregated {
+		return LimitedByReceiveFlowControl
+	}
+	if !sending {
+		return ""
+	}
+	if r.FlowControlBlockedSending*2 >= r.TimeAggregated {
+		return LimitedBySendFlowControl
+	}
+	// bytes in flight are close to the congestion window on average
+	if r.CongestionWindow.Samples != 0 && r.BytesInFlight.Average*10 >= r.CongestionWindow.Average*8 {
+		return LimitedByCongestionControl
+	}
+	return LimitedByApplication
+}
+
+// HasRTT returns false if there was no RTT sample during the aggregated time
+func (r Report) HasRTT() bool {
+	return r.MinRTT <= r.MaxRTT
+}
+
+// DatagramLossPercentage returns the share of lost datagrams of all datagrams that were expected to arrive.
+func (r Report) DatagramLossPercentage() float32 {
+	expected := r.ReceivedDatagrams - r.DuplicateDatagrams + r.LostDatagrams
+	if expected == 0 {
+		return 0
+	}
+	return float32(r.LostDatagrams) / float32(expected) * 100
 }
@@ -0,0 +1,244 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SizeDistribution samples the lengths of requests and responses
+type SizeDistribution interface {
+	Sample(r *rand.Rand) uint64
+	String() string
+}
+
+// FixedSize always returns the same length
+type FixedSize uint64
+
+func (s FixedSize) Sample(*rand.Rand) uint64 {
+	return uint64(s)
+}
+
+func (s FixedSize) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+// UniformSize returns lengths between Min and Max, both inclusive
+type UniformSize struct {
+	Min uint64
+	Max uint64
+}
+
+func (s UniformSize) Sample(r *rand.Rand) uint64 {
+	if s.Max-s.Min == math.MaxUint64 {
+		return r.Uint64()
+	}
+	return s.Min + r.Uint64N(s.Max-s.Min+1)
+}
+
+func (s UniformSize) String() string {
+	return fmt.Sprintf("uniform(%d,%d)", s.Min, s.Max)
+}
+
+// ExponentialSize returns exponentially distributed lengths
+type ExponentialSize struct {
+	Mean float64
+}
+
+func (s ExponentialSize) Sample(r *rand.Rand) uint64 {
+	return float64ToSize(r.ExpFloat64() * s.Mean)
+}
+
+func (s ExponentialSize) String() string {
+	return fmt.Sprintf("exponential(%s)", strconv.FormatFloat(s.Mean, 'f', -1, 64))
+}
+
+// LognormalSize returns lengths whose natural logarithm is normally distributed with mean Mu and standard deviation Sigma
+type LognormalSize struct {
+	Mu    float64
+	Sigma float64
+}
+
+func (s LognormalSize) Sample(r *rand.Rand) uint64 {
+	return float64ToSize(math.Exp(s.Mu + s.Sigma*r.NormFloat64()))
+}
+
+func (s LognormalSize) String() string {
+	return fmt.Sprintf("lognormal(%s,%s)", strconv.FormatFloat(s.Mu, 'f', -1, 64), strconv.FormatFloat(s.Sigma, 'f', -1, 64))
+}
+
+// EmpiricalSize returns lengths according to a cumulative distribution function,
+// linearly interpolated between its points.
+type EmpiricalSize struct {
+	// for String
+	path  string
+	sizes []uint64
+	// cumulative probabilities, ascending, the last one is 1
+	probabilities []float64
+}
+
+// NewEmpiricalSize creates a distribution from the points of a cumulative distribution function.
+// Sizes and probabilities must be ascending, the last probability must be 1.
+func NewEmpiricalSize(sizes []uint64, probabilities []float64) (*EmpiricalSize, error) {
+	if len(sizes) == 0 || len(sizes) != len(probabilities) {
+		return nil, errors.New("sizes and probabilities must be non-empty and of equal length")
+	}
+	for i := range sizes {
+		if probabilities[i] < 0 || probabilities[i] > 1 {
+			return nil, fmt.Errorf("probability %v is not between 0 and 1", probabilities[i])
+		}
+		if i > 0 && (sizes[i] < sizes[i-1] || probabilities[i] < probabilities[i-1]) {
+			return nil, errors.New("sizes and probabilities must be ascending")
+		}
+	}
+	if probabilities[len(probabilities)-1] != 1 {
+		return nil, errors.New("last probability must be 1")
+	}
+	return &EmpiricalSize{
+		sizes:         sizes,
+		probabilities: probabilities,
+	}, nil
+}
+
+// LoadEmpiricalSize reads a cumulative distribution function from a file.
+// Every line contains a size and its cumulative probability, separated by whitespace or a comma.
+// Empty lines and lines starting with # are ignored.
+func LoadEmpiricalSize(path string) (*EmpiricalSize, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sizes []uint64
+	var probabilities []float64
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected size and probability", lineNumber)
+		}
+		size, err := ParseByteCountWithUnit(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse size: %w", lineNumber, err)
+		}
+		probability, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse probability: %w", lineNumber, err)
+		}
+		sizes = append(sizes, size)
+		probabilities = append(probabilities, probability)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	d, err := NewEmpiricalSize(sizes, probabilities)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	d.path = path
+	return d, nil
+}
+
+func (s *EmpiricalSize) Sample(r *rand.Rand) uint64 {
+	p := r.Float64()
+	i := sort.SearchFloat64s(s.probabilities, p)
+	if i == 0 {
+		return s.sizes[0]
+	}
+	lowerSize, upperSize := float64(s.sizes[i-1]), float64(s.sizes[i])
+	lowerProbability, upperProbability := s.probabilities[i-1], s.probabilities[i]
+	return float64ToSize(lowerSize + (upperSize-lowerSize)*(p-lowerProbability)/(upperProbability-lowerProbability))
+}
+
+func (s *EmpiricalSize) String() string {
+	return fmt.Sprintf("cdf(%s)", s.path)
+}
+
+func float64ToSize(f float64) uint64 {
+	if f >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(math.Round(Max(f, 0)))
+}
+
+// ParseSizeDistribution supports the following formats:
+// a fixed size like 1000 or 64KiB, see ParseByteCountWithUnit;
+// uniform(min,max); exponential(mean) or exp(mean); lognormal(mu,sigma) of the natural logarithm of the size;
+// cdf(path) to load an empirical distribution, see LoadEmpiricalSize.
+func ParseSizeDistribution(s string) (SizeDistribution, error) {
+	expr := regexp.MustCompile("^\\s*(\\w+)\\s*\\((.*)\\)\\s*$")
+	match := expr.FindStringSubmatch(s)
+	if match == nil {
+		size, err := ParseByteCountWithUnit(s)
+		if err != nil {
+			return nil, err
+		}
+		return FixedSize(size), nil
+	}
+	name := strings.ToLower(match[1])
+	if name == "cdf" {
+		return LoadEmpiricalSize(strings.TrimSpace(match[2]))
+	}
+	args := strings.Split(match[2], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	switch name {
+	case "uniform":
+		if len(args) != 2 {
+			return nil, errors.New("uniform requires min and max")
+		}
+		minSize, err := ParseByteCountWithUnit(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse min: %w", err)
+		}
+		maxSize, err := ParseByteCountWithUnit(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse max: %w", err)
+		}
+		if minSize > maxSize {
+			return nil, errors.New("min must not exceed max")
+		}
+		return UniformSize{Min: minSize, Max: maxSize}, nil
+	case "exponential", "exp":
+		if len(args) != 1 {
+			return nil, errors.New("exponential requires mean")
+		}
+		mean, err := ParseByteCountWithUnit(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse mean: %w", err)
+		}
+		return ExponentialSize{Mean: float64(mean)}, nil
+	case "lognormal":
+		if len(args) != 2 {
+			return nil, errors.New("lognormal requires mu and sigma")
+		}
+		mu, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse mu: %w", err)
+		}
+		sigma, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sigma: %w", err)
+		}
+		if sigma < 0 {
+			return nil, errors.New("sigma must not be negative")
+		}
+		return LognormalSize{Mu: mu, Sigma: sigma}, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %s", name)
+	}
+}
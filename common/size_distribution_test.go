@@ -0,0 +1,76 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand/v2"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseSizeDistribution(t *testing.T) {
+	for s, expected := range map[string]SizeDistribution{
+		"1000":              FixedSize(1000),
+		"64KiB":             FixedSize(64 * 1024),
+		"uniform(1,1kb)":    UniformSize{Min: 1, Max: 1000},
+		"exponential(2000)": ExponentialSize{Mean: 2000},
+		"exp(1KiB)":         ExponentialSize{Mean: 1024},
+		"lognormal(8, 1.5)": LognormalSize{Mu: 8, Sigma: 1.5},
+	} {
+		d, err := ParseSizeDistribution(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+	for _, s := range []string{"uniform(2,1)", "uniform(1)", "lognormal(1,-1)", "pareto(1)", "cdf(/does/not/exist)"} {
+		_, err := ParseSizeDistribution(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSizeDistributionSeeded(t *testing.T) {
+	d := LognormalSize{Mu: 8, Sigma: 1}
+	r1 := rand.New(rand.NewPCG(1, 1))
+	r2 := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, d.Sample(r1), d.Sample(r2))
+	}
+}
+
+func TestUniformSize(t *testing.T) {
+	d := UniformSize{Min: 10, Max: 12}
+	r := rand.New(rand.NewPCG(1, 1))
+	seen := map[uint64]bool{}
+	for i := 0; i < 1000; i++ {
+		seen[d.Sample(r)] = true
+	}
+	assert.Equal(t, map[uint64]bool{10: true, 11: true, 12: true}, seen)
+}
+
+func TestEmpiricalSize(t *testing.T) {
+	file := path.Join(t.TempDir(), "cdf.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# size probability\n100 0.5\n\n1000, 0.9\n10000 1\n"), 0600))
+	d, err := ParseSizeDistribution("cdf(" + file + ")")
+	require.NoError(t, err)
+	assert.Equal(t, "cdf("+file+")", d.String())
+	r := rand.New(rand.NewPCG(1, 1))
+	var atMost100, atMost1000 int
+	for i := 0; i < 10000; i++ {
+		size := d.Sample(r)
+		assert.GreaterOrEqual(t, size, uint64(100))
+		assert.LessOrEqual(t, size, uint64(10000))
+		if size <= 100 {
+			atMost100++
+		}
+		if size <= 1000 {
+			atMost1000++
+		}
+	}
+	assert.InDelta(t, 5000, atMost100, 200)
+	assert.InDelta(t, 9000, atMost1000, 200)
+
+	_, err = NewEmpiricalSize([]uint64{100, 10}, []float64{0.5, 1})
+	assert.Error(t, err)
+	_, err = NewEmpiricalSize([]uint64{10, 100}, []float64{0.5, 0.9})
+	assert.Error(t, err)
+}
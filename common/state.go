@@ -24,6 +24,21 @@ type State struct {
 	totalSentDatagramBytes         logging.ByteCount
 	totalReceivedResponses         uint64
 	totalDeadlineExceededResponses uint64
+	totalReceivedDatagrams         uint64
+	totalLostDatagrams             int64
+	totalOutOfOrderDatagrams       uint64
+	totalDuplicateDatagrams        uint64
+	totalCongestionWindow          byteCountAggregator
+	totalBytesInFlight             byteCountAggregator
+	totalRequestLatencies          Histogram
+	totalRequestLengths            byteCountAggregator
+	totalResponseLengths           byteCountAggregator
+	zeroRTT                        ZeroRTTStats
+	verification                   VerificationStats
+	// transport metrics by the index of the parallel connection, see StateTracer.Connection
+	connections map[int]*connectionMetrics
+	// by flow, e.g. the index of the connection
+	datagramTrackers map[int]*datagramTracker
 	// contexts
 	handshakeCompletedCtx    context.Context
 	handshakeCompletedCancel context.CancelFunc
@@ -39,17 +54,33 @@ type State struct {
 	lastReportReceivedPackets     uint64
 	minRTT                        time.Duration
 	maxRTT                        time.Duration
-	smoothedRTT                   time.Duration
 	packetsLost                   uint64
 	lastReportSentBytes           uint64
 	intervalReceivedDatagramBytes logging.ByteCount
 	intervalSentDatagramBytes     logging.ByteCount
 	receivedResponses             uint64
 	deadlineExceededResponses     uint64
+	receivedDatagrams             uint64
+	// negative if late datagrams arrive that were counted as lost in a previous interval
+	lostDatagrams       int64
+	outOfOrderDatagrams uint64
+	duplicateDatagrams  uint64
+	congestionWindow    byteCountAggregator
+	requestLatencies    Histogram
+	requestLengths      byteCountAggregator
+	responseLengths     byteCountAggregator
+	bytesInFlight       byteCountAggregator
 }
 
 func NewState() *State {
-	s := &State{}
+	s := &State{
+		datagramTrackers: map[int]*datagramTracker{},
+		connections:      map[int]*connectionMetrics{},
+		minRTT:           MaxDuration,
+		totalMinRTT:      MaxDuration,
+		maxRTT:           MinDuration,
+		totalMaxRTT:      MinDuration,
+	}
 	s.resetContexts()
 	return s
 }
@@ -71,19 +102,35 @@ func (s *State) GetAndResetReport() Report {
 	now := time.Now()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	smoothedRTT, rttVariance, latestRTT := s.averageRTTs()
+	blockedSending, blockedReceiving := s.averageBlockedTimes(now, true)
 	report := Report{
-		ReceivedBytes:             logging.ByteCount(s.totalReceivedStreamBytes - s.lastReportReceivedBytes),
-		ReceivedPackets:           s.totalReceivedPackets - s.lastReportReceivedPackets,
-		TimeAggregated:            now.Sub(MaxTime([]time.Time{s.lastReportTime, s.startTime})),
-		MinRTT:                    s.minRTT,
-		MaxRTT:                    s.maxRTT,
-		SmoothedRTT:               s.smoothedRTT,
-		PacketsLost:               s.packetsLost,
-		SentBytes:                 logging.ByteCount(s.totalSentStreamBytes - s.lastReportSentBytes),
-		ReceivedDatagramBytes:     s.intervalReceivedDatagramBytes,
-		SentDatagramBytes:         s.intervalSentDatagramBytes,
-		ReceivedResponses:         s.receivedResponses,
-		DeadlineExceededResponses: s.deadlineExceededResponses,
+		ReceivedBytes:               logging.ByteCount(s.totalReceivedStreamBytes - s.lastReportReceivedBytes),
+		ReceivedPackets:             s.totalReceivedPackets - s.lastReportReceivedPackets,
+		TimeAggregated:              now.Sub(MaxTime([]time.Time{s.lastReportTime, s.startTime})),
+		MinRTT:                      s.minRTT,
+		MaxRTT:                      s.maxRTT,
+		SmoothedRTT:                 smoothedRTT,
+		RTTVariance:                 rttVariance,
+		LatestRTT:                   latestRTT,
+		PacketsLost:                 s.packetsLost,
+		SentBytes:                   logging.ByteCount(s.totalSentStreamBytes - s.lastReportSentBytes),
+		ReceivedDatagramBytes:       s.intervalReceivedDatagramBytes,
+		SentDatagramBytes:           s.intervalSentDatagramBytes,
+		ReceivedResponses:           s.receivedResponses,
+		DeadlineExceededResponses:   s.deadlineExceededResponses,
+		ReceivedDatagrams:           s.receivedDatagrams,
+		LostDatagrams:               uint64(Max(s.lostDatagrams, 0)),
+		OutOfOrderDatagrams:         s.outOfOrderDatagrams,
+		DuplicateDatagrams:          s.duplicateDatagrams,
+		DatagramJitter:              s.datagramJitter(),
+		CongestionWindow:            s.congestionWindow.stats(),
+		BytesInFlight:               s.bytesInFlight.stats(),
+		FlowControlBlockedSending:   blockedSending,
+		FlowControlBlockedReceiving: blockedReceiving,
+		RequestLatency:              s.requestLatencies.Summary(),
+		RequestLength:               s.requestLengths.stats(),
+		ResponseLength:              s.responseLengths.stats(),
 	}
 	// reset
 	s.lastReportTime = now
@@ -92,12 +139,20 @@ func (s *State) GetAndResetReport() Report {
 	s.lastReportSentBytes = s.totalSentStreamBytes
 	s.minRTT = MaxDuration
 	s.maxRTT = MinDuration
-	s.smoothedRTT = -1
 	s.packetsLost = 0
 	s.intervalReceivedDatagramBytes = 0
 	s.intervalSentDatagramBytes = 0
 	s.receivedResponses = 0
 	s.deadlineExceededResponses = 0
+	s.receivedDatagrams = 0
+	s.lostDatagrams = 0
+	s.outOfOrderDatagrams = 0
+	s.duplicateDatagrams = 0
+	s.congestionWindow.reset()
+	s.requestLatencies.Reset()
+	s.requestLengths.reset()
+	s.responseLengths.reset()
+	s.bytesInFlight.reset()
 	return report
 }
 
@@ -105,18 +160,37 @@ func (s *State) TotalReport() Report {
 	now := time.Now()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	smoothedRTT, rttVariance, latestRTT := s.averageRTTs()
+	blockedSending, blockedReceiving := s.averageBlockedTimes(now, false)
 	report := Report{
-		ReceivedBytes:             logging.ByteCount(s.totalReceivedStreamBytes),
-		ReceivedPackets:           s.totalReceivedPackets,
-		TimeAggregated:            now.Sub(s.startTime),
-		MinRTT:                    s.totalMinRTT,
-		MaxRTT:                    s.totalMaxRTT,
-		PacketsLost:               s.totalPacketsLost,
-		SentBytes:                 logging.ByteCount(s.totalSentStreamBytes),
-		ReceivedDatagramBytes:     s.totalReceivedDatagramBytes,
-		SentDatagramBytes:         s.totalSentDatagramBytes,
-		ReceivedResponses:         s.totalReceivedResponses,
-		DeadlineExceededResponses: s.totalDeadlineExceededResponses,
+		ReceivedBytes:               logging.ByteCount(s.totalReceivedStreamBytes),
+		ReceivedPackets:             s.totalReceivedPackets,
+		TimeAggregated:              now.Sub(s.startTime),
+		MinRTT:                      s.totalMinRTT,
+		MaxRTT:                      s.totalMaxRTT,
+		SmoothedRTT:                 smoothedRTT,
+		RTTVariance:                 rttVariance,
+		LatestRTT:                   latestRTT,
+		PacketsLost:                 s.totalPacketsLost,
+		SentBytes:                   logging.ByteCount(s.totalSentStreamBytes),
+		ReceivedDatagramBytes:       s.totalReceivedDatagramBytes,
+		SentDatagramBytes:           s.totalSentDatagramBytes,
+		ReceivedResponses:           s.totalReceivedResponses,
+		DeadlineExceededResponses:   s.totalDeadlineExceededResponses,
+		ReceivedDatagrams:           s.totalReceivedDatagrams,
+		LostDatagrams:               uint64(Max(s.totalLostDatagrams, 0)),
+		OutOfOrderDatagrams:         s.totalOutOfOrderDatagrams,
+		DuplicateDatagrams:          s.totalDuplicateDatagrams,
+		DatagramJitter:              s.datagramJitter(),
+		CongestionWindow:            s.totalCongestionWindow.stats(),
+		BytesInFlight:               s.totalBytesInFlight.stats(),
+		FlowControlBlockedSending:   blockedSending,
+		FlowControlBlockedReceiving: blockedReceiving,
+		RequestLatency:              s.totalRequestLatencies.Summary(),
+		RequestLength:               s.totalRequestLengths.stats(),
+		ResponseLength:              s.totalResponseLengths.stats(),
+		ZeroRTT:                     s.zeroRTT,
+		Verification:                s.verification.clone(),
 	}
 	return report
 }
@@ -152,14 +226,104 @@ func (s *State) FirstByteSentTime() time.Time {
 	return s.firstByteSentTime
 }
 
-func (s *State) AddRttStats(stats *logging.RTTStats) {
+// AddRttStats updates the RTT of the connection with the given index.
+// Min and max are taken over all connections, the other estimates are averaged over the connections.
+func (s *State) AddRttStats(connection int, stats *logging.RTTStats) {
+	if stats.LatestRTT() == 0 {
+		return // no RTT sample yet
+	}
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.minRTT = Min(stats.LatestRTT(), s.minRTT)
 	s.totalMinRTT = Min(stats.LatestRTT(), s.totalMinRTT)
 	s.maxRTT = Max(stats.LatestRTT(), s.maxRTT)
 	s.totalMaxRTT = Max(stats.LatestRTT(), s.totalMaxRTT)
-	s.smoothedRTT = stats.SmoothedRTT()
+	metrics := s.connectionMetrics(connection)
+	metrics.smoothedRTT = stats.SmoothedRTT()
+	metrics.rttVariance = stats.MeanDeviation()
+	metrics.latestRTT = stats.LatestRTT()
+}
+
+// AddCongestionMetrics updates the congestion window and bytes in flight of the connection with the given index.
+// Every update adds a sample of the sums over all connections.
+func (s *State) AddCongestionMetrics(connection int, congestionWindow logging.ByteCount, bytesInFlight logging.ByteCount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	metrics := s.connectionMetrics(connection)
+	metrics.congestionWindow = congestionWindow
+	metrics.bytesInFlight = bytesInFlight
+	var congestionWindowSum, bytesInFlightSum logging.ByteCount
+	for _, m := range s.connections {
+		congestionWindowSum += m.congestionWindow
+		bytesInFlightSum += m.bytesInFlight
+	}
+	s.congestionWindow.add(congestionWindowSum)
+	s.totalCongestionWindow.add(congestionWindowSum)
+	s.bytesInFlight.add(bytesInFlightSum)
+	s.totalBytesInFlight.add(bytesInFlightSum)
+}
+
+// SetFlowControlBlocked is called whenever the data of the connection with the given index becomes blocked or unblocked by flow control.
+// sending is true for our data, blocked by the limits of the peer.
+// Reports contain the blocked time averaged over the connections.
+func (s *State) SetFlowControlBlocked(connection int, sending bool, blocked bool) {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	metrics := s.connectionMetrics(connection)
+	if sending {
+		metrics.flowControlBlockedSending.set(blocked, now)
+	} else {
+		metrics.flowControlBlockedReceiving.set(blocked, now)
+	}
+}
+
+// must only be called while holding the lock
+func (s *State) connectionMetrics(connection int) *connectionMetrics {
+	metrics, ok := s.connections[connection]
+	if !ok {
+		metrics = &connectionMetrics{}
+		s.connections[connection] = metrics
+	}
+	return metrics
+}
+
+// averageRTTs averages the RTT estimates over the connections with an RTT sample.
+// Must only be called while holding the lock.
+func (s *State) averageRTTs() (smoothedRTT, rttVariance, latestRTT time.Duration) {
+	var n time.Duration
+	for _, metrics := range s.connections {
+		if metrics.latestRTT != 0 {
+			smoothedRTT += metrics.smoothedRTT
+			rttVariance += metrics.rttVariance
+			latestRTT += metrics.latestRTT
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return smoothedRTT / n, rttVariance / n, latestRTT / n
+}
+
+// averageBlockedTimes averages the flow control blocked times over the connections,
+// either of the current interval, which is reset, or in total.
+// Must only be called while holding the lock.
+func (s *State) averageBlockedTimes(now time.Time, interval bool) (sending, receiving time.Duration) {
+	if len(s.connections) == 0 {
+		return 0, 0
+	}
+	for _, metrics := range s.connections {
+		if interval {
+			sending += metrics.flowControlBlockedSending.getAndResetInterval(now)
+			receiving += metrics.flowControlBlockedReceiving.getAndResetInterval(now)
+		} else {
+			sending += metrics.flowControlBlockedSending.getTotal(now)
+			receiving += metrics.flowControlBlockedReceiving.getTotal(now)
+		}
+	}
+	n := time.Duration(len(s.connections))
+	return sending / n, receiving / n
 }
 
 func (s *State) MinRTT() time.Duration {
@@ -177,7 +341,22 @@ func (s *State) MaxRTT() time.Duration {
 func (s *State) SmoothedRTT() time.Duration {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	return s.smoothedRTT
+	smoothedRTT, _, _ := s.averageRTTs()
+	return smoothedRTT
+}
+
+func (s *State) RTTVariance() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, rttVariance, _ := s.averageRTTs()
+	return rttVariance
+}
+
+func (s *State) LatestRTT() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, _, latestRTT := s.averageRTTs()
+	return latestRTT
 }
 
 func (s *State) AddLostPackets(n uint64) {
@@ -204,22 +383,51 @@ func (s *State) SetHandshakeConfirmedTime() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.handshakeConfirmedTime = time.Now()
+	s.handshakeConfirmedCancel()
 }
 
 func (s *State) AwaitHandshakeCompleted() {
-	<-s.handshakeCompletedCtx.Done()
+	<-s.HandshakeCompletedChan()
 }
 
 func (s *State) AwaitHandshakeConfirmed() {
-	<-s.handshakeConfirmedCtx.Done()
+	<-s.HandshakeConfirmedChan()
 }
 
 func (s *State) AwaitFirstByteReceived() {
-	<-s.firstByteReceivedCtx.Done()
+	<-s.FirstByteReceivedChan()
+}
+
+// FirstByteReceivedChan is closed when the first byte is received
+func (s *State) FirstByteReceivedChan() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.firstByteReceivedCtx.Done()
 }
 
 func (s *State) AwaitFirstByteSent() {
-	<-s.firstByteSentCtx.Done()
+	<-s.FirstByteSentChan()
+}
+
+// FirstByteSentChan is closed when the first byte is sent
+func (s *State) FirstByteSentChan() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.firstByteSentCtx.Done()
+}
+
+// HandshakeCompletedChan is closed when the handshake is completed
+func (s *State) HandshakeCompletedChan() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.handshakeCompletedCtx.Done()
+}
+
+// HandshakeConfirmedChan is closed when the handshake is confirmed
+func (s *State) HandshakeConfirmedChan() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.handshakeConfirmedCtx.Done()
 }
 
 func (s *State) HandshakeCompletedTime() time.Time {
@@ -285,6 +493,50 @@ func (s *State) AddSentDatagramBytes(length logging.ByteCount) {
 	s.maybeSetFirstByteSent()
 }
 
+// AddReceivedDatagram updates loss, reordering and jitter statistics of payload datagrams.
+// Every flow has its own sequence numbers, starting at 0.
+func (s *State) AddReceivedDatagram(flow int, sequenceNumber uint64, sendTime time.Time, receiveTime time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tracker, ok := s.datagramTrackers[flow]
+	if !ok {
+		tracker = &datagramTracker{}
+		s.datagramTrackers[flow] = tracker
+	}
+	lost, outOfOrder, duplicate := tracker.add(sequenceNumber, sendTime, receiveTime)
+	s.receivedDatagrams++
+	s.totalReceivedDatagrams++
+	s.lostDatagrams += lost
+	s.totalLostDatagrams += lost
+	if outOfOrder {
+		s.outOfOrderDatagrams++
+		s.totalOutOfOrderDatagrams++
+	}
+	if duplicate {
+		s.duplicateDatagrams++
+		s.totalDuplicateDatagrams++
+	}
+}
+
+// ResetDatagramFlow must be called when the sequence numbers of a flow start again, e.g. on reconnect.
+func (s *State) ResetDatagramFlow(flow int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.datagramTrackers, flow)
+}
+
+// must only be called while holding the lock
+func (s *State) datagramJitter() time.Duration {
+	if len(s.datagramTrackers) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, tracker := range s.datagramTrackers {
+		sum += tracker.jitter
+	}
+	return sum / time.Duration(len(s.datagramTrackers))
+}
+
 func (s *State) ResetForReconnect() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -321,9 +573,91 @@ func (s *State) AddReceivedResponses(i uint64) {
 	s.receivedResponses += i
 }
 
+// AddRequestLatency records the time from sending a request until its response is completely received
+func (s *State) AddRequestLatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requestLatencies.Record(latency)
+	s.totalRequestLatencies.Record(latency)
+}
+
+// AddRequestLengths records the sampled lengths of a started request and its response
+func (s *State) AddRequestLengths(requestLength uint64, responseLength uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requestLengths.add(logging.ByteCount(requestLength))
+	s.totalRequestLengths.add(logging.ByteCount(requestLength))
+	s.responseLengths.add(logging.ByteCount(responseLength))
+	s.totalResponseLengths.add(logging.ByteCount(responseLength))
+}
+
+// AddSentZeroRTTPacket counts a sent 0-RTT packet of the given size
+func (s *State) AddSentZeroRTTPacket(size logging.ByteCount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.zeroRTT.PacketsSent++
+	s.zeroRTT.BytesSent += size
+}
+
+// AddReceivedZeroRTTPacket counts a received 0-RTT packet of the given size, including dropped packets
+func (s *State) AddReceivedZeroRTTPacket(size logging.ByteCount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.zeroRTT.PacketsReceived++
+	s.zeroRTT.BytesReceived += size
+}
+
+// AddZeroRTTAttempted must be called at most once per connection
+func (s *State) AddZeroRTTAttempted() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.zeroRTT.Attempted++
+}
+
+// AddZeroRTTAccepted must be called at most once per connection, after the handshake completed
+func (s *State) AddZeroRTTAccepted() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.zeroRTT.Accepted++
+}
+
+// AddVerificationResult counts the verified bytes of a received stream,
+// and the stream itself if it failed or was received completely.
+// Must be called at most once per stream.
+func (s *State) AddVerificationResult(streamID int64, verifiedBytes uint64, complete bool, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.verification.BytesVerified += verifiedBytes
+	if failed {
+		s.verification.StreamsFailed++
+		s.verification.FailedStreams = append(s.verification.FailedStreams, streamID)
+	} else if complete {
+		s.verification.StreamsVerified++
+	}
+}
+
+func (s *State) ZeroRTT() ZeroRTTStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.zeroRTT
+}
+
 func (s *State) AddDeadlineExceededResponses(i uint64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.totalDeadlineExceededResponses += i
 	s.deadlineExceededResponses += i
 }
+
+// connectionMetrics are the current transport metrics of one of the parallel connections
+type connectionMetrics struct {
+	smoothedRTT      time.Duration
+	rttVariance      time.Duration
+	latestRTT        time.Duration
+	congestionWindow logging.ByteCount
+	bytesInFlight    logging.ByteCount
+	// time during which our data was blocked by the flow control limits of the peer
+	flowControlBlockedSending blockedTimer
+	// time during which the data of the peer was blocked by our flow control limits
+	flowControlBlockedReceiving blockedTimer
+}
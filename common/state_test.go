@@ -0,0 +1,38 @@
+package common
+
+import (
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStateParallelConnections(t *testing.T) {
+	state := NewState()
+	state.SetStartTime()
+	var rtt0, rtt1 logging.RTTStats
+	rtt0.UpdateRTT(10*time.Millisecond, 0, time.Now())
+	rtt1.UpdateRTT(30*time.Millisecond, 0, time.Now())
+	state.AddRttStats(0, &rtt0)
+	state.AddRttStats(1, &rtt1)
+	state.AddCongestionMetrics(0, 100, 50)
+	state.AddCongestionMetrics(1, 200, 100)
+
+	start := time.Now()
+	state.SetFlowControlBlocked(0, true, true)
+	time.Sleep(20 * time.Millisecond)
+	state.SetFlowControlBlocked(0, true, false)
+	elapsed := time.Since(start)
+
+	report := state.TotalReport()
+	assert.Equal(t, 10*time.Millisecond, report.MinRTT)
+	assert.Equal(t, 30*time.Millisecond, report.MaxRTT)
+	assert.Equal(t, 20*time.Millisecond, report.LatestRTT)
+	assert.Equal(t, 20*time.Millisecond, report.SmoothedRTT)
+	assert.Equal(t, logging.ByteCount(300), report.CongestionWindow.Current)
+	assert.Equal(t, logging.ByteCount(150), report.BytesInFlight.Current)
+	// only one of two connections was blocked
+	assert.GreaterOrEqual(t, report.FlowControlBlockedSending, 10*time.Millisecond)
+	assert.LessOrEqual(t, report.FlowControlBlockedSending, elapsed/2)
+	assert.Zero(t, report.FlowControlBlockedReceiving)
+}
@@ -8,22 +8,46 @@ import (
 
 type StateTracer struct {
 	State *State
+	// Connection is the index of the parallel connection the transport metrics are recorded for
+	Connection int
+	// ControlStream is not counted as application data for the first byte times, nil if there is none
+	ControlStream *logging.StreamID
+	// OnFlowControlBlocked is called when a connection or stream becomes blocked, optional
+	OnFlowControlBlocked func(event FlowControlBlockedEvent)
 }
 
 func (t StateTracer) TracerForConnection(_ context.Context, _ logging.Perspective, _ logging.ConnectionID) *logging.ConnectionTracer {
+	flowControl := &connectionFlowControl{
+		tracer:    t,
+		sending:   newFlowControlTracker(),
+		receiving: newFlowControlTracker(),
+	}
+	// only accessed by the run loop of the connection
+	zeroRTTAttempted := false
+	maybeSetZeroRTTAttempted := func() {
+		if !zeroRTTAttempted {
+			zeroRTTAttempted = true
+			t.State.AddZeroRTTAttempted()
+		}
+	}
 	return &logging.ConnectionTracer{
-		ReceivedLongHeaderPacket: func(_ *logging.ExtendedHeader, _ logging.ByteCount, _ logging.ECN, _ []logging.Frame) {
+		ReceivedLongHeaderPacket: func(header *logging.ExtendedHeader, count logging.ByteCount, _ logging.ECN, frames []logging.Frame) {
 			t.State.AddReceivedPackets(1)
+			if logging.PacketTypeFromHeader(&header.Header) == logging.PacketType0RTT {
+				t.State.AddReceivedZeroRTTPacket(count)
+				maybeSetZeroRTTAttempted()
+			}
+			flowControl.handleFrames(frames, false)
 		},
 		ReceivedShortHeaderPacket: func(_ *logging.ShortHeader, _ logging.ByteCount, _ logging.ECN, frames []logging.Frame) {
 			t.State.AddReceivedPackets(1)
+			flowControl.handleFrames(frames, false)
 			for _, frame := range frames {
 				switch frame := frame.(type) {
 				case *logging.HandshakeDoneFrame:
 					t.State.SetHandshakeConfirmedTime()
-					t.State.handshakeConfirmedCancel()
 				case *logging.StreamFrame:
-					if frame.Offset == 0 {
+					if t.isFirstApplicationData(frame) {
 						t.State.MaybeSetFirstByteReceived()
 					}
 				case *logging.DatagramFrame:
@@ -32,10 +56,15 @@ func (t StateTracer) TracerForConnection(_ context.Context, _ logging.Perspectiv
 			}
 		},
 		SentLongHeaderPacket: func(header *logging.ExtendedHeader, count logging.ByteCount, ecn logging.ECN, frame *logging.AckFrame, frames []logging.Frame) {
+			flowControl.handleFrames(frames, true)
+			if logging.PacketTypeFromHeader(&header.Header) == logging.PacketType0RTT {
+				t.State.AddSentZeroRTTPacket(count)
+				maybeSetZeroRTTAttempted()
+			}
 			for _, frame := range frames {
 				switch frame := frame.(type) {
 				case *logging.StreamFrame:
-					if frame.Offset == 0 {
+					if t.isFirstApplicationData(frame) {
 						t.State.MaybeSetFirstByteSent()
 					}
 				case *logging.DatagramFrame:
@@ -44,10 +73,11 @@ func (t StateTracer) TracerForConnection(_ context.Context, _ logging.Perspectiv
 			}
 		},
 		SentShortHeaderPacket: func(header *logging.ShortHeader, count logging.ByteCount, ecn logging.ECN, frame *logging.AckFrame, frames []logging.Frame) {
+			flowControl.handleFrames(frames, true)
 			for _, frame := range frames {
 				switch frame := frame.(type) {
 				case *logging.StreamFrame:
-					if frame.Offset == 0 {
+					if t.isFirstApplicationData(frame) {
 						t.State.MaybeSetFirstByteSent()
 					}
 				case *logging.DatagramFrame:
@@ -56,13 +86,23 @@ func (t StateTracer) TracerForConnection(_ context.Context, _ logging.Perspectiv
 			}
 		},
 		UpdatedMetrics: func(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
-			t.State.AddRttStats(rttStats)
-
+			t.State.AddRttStats(t.Connection, rttStats)
+			t.State.AddCongestionMetrics(t.Connection, cwnd, bytesInFlight)
+		},
+		DroppedPacket: func(packetType logging.PacketType, _ logging.PacketNumber, size logging.ByteCount, _ logging.PacketDropReason) {
+			// the server drops 0-RTT packets if it rejects 0-RTT
+			if packetType == logging.PacketType0RTT {
+				t.State.AddReceivedZeroRTTPacket(size)
+				maybeSetZeroRTTAttempted()
+			}
 		},
 		LostPacket: func(level logging.EncryptionLevel, number logging.PacketNumber, reason logging.PacketLossReason) {
 			t.State.AddLostPackets(1)
 
 		},
+		ClosedConnection: func(err error) {
+			flowControl.close()
+		},
 		UpdatedKeyFromTLS: func(level logging.EncryptionLevel, perspective logging.Perspective) {
 			if level == logging.Encryption1RTT {
 				now := time.Now()
@@ -72,8 +112,89 @@ func (t StateTracer) TracerForConnection(_ context.Context, _ logging.Perspectiv
 	}
 }
 
+// isFirstApplicationData returns true if the frame starts a stream other than the control stream
+func (t StateTracer) isFirstApplicationData(frame *logging.StreamFrame) bool {
+	return frame.Offset == 0 && (t.ControlStream == nil || frame.StreamID != *t.ControlStream)
+}
+
 func NewStateTracer(state *State) *StateTracer {
 	return &StateTracer{
 		State: state,
 	}
 }
+
+// connectionFlowControl follows the flow control of both directions of a connection
+type connectionFlowControl struct {
+	tracer StateTracer
+	// our data, limited by the peer
+	sending *flowControlTracker
+	// data of the peer, limited by us
+	receiving *flowControlTracker
+}
+
+// handleFrames updates the flow control state by the frames of a sent or received packet
+func (c *connectionFlowControl) handleFrames(frames []logging.Frame, sent bool) {
+	for _, frame := range frames {
+		// the blocked frames are sent by the blocked side, the limits by the other side
+		blockedSide, limitingSide := c.receiving, c.sending
+		if sent {
+			blockedSide, limitingSide = c.sending, c.receiving
+		}
+		switch frame := frame.(type) {
+		case *logging.DataBlockedFrame:
+			c.update(blockedSide, func() bool {
+				return blockedSide.connectionBlockedAt(frame.MaximumData)
+			}, nil, frame.MaximumData)
+		case *logging.StreamDataBlockedFrame:
+			c.update(blockedSide, func() bool {
+				return blockedSide.streamBlockedAt(frame.StreamID, frame.MaximumStreamData)
+			}, &frame.StreamID, frame.MaximumStreamData)
+		case *logging.MaxDataFrame:
+			c.update(limitingSide, func() bool {
+				limitingSide.maxData(frame.MaximumData)
+				return false
+			}, nil, 0)
+		case *logging.MaxStreamDataFrame:
+			c.update(limitingSide, func() bool {
+				limitingSide.maxStreamData(frame.StreamID, frame.MaximumStreamData)
+				return false
+			}, nil, 0)
+		}
+	}
+}
+
+// update applies f to the tracker and notifies the state if the tracker becomes blocked or unblocked.
+// f returns true if a connection or stream is newly blocked, which is recorded as event.
+func (c *connectionFlowControl) update(tracker *flowControlTracker, f func() bool, streamID *logging.StreamID, limit logging.ByteCount) {
+	tracker.mutex.Lock()
+	wasBlocked := tracker.blocked()
+	newlyBlocked := f()
+	isBlocked := tracker.blocked()
+	tracker.mutex.Unlock()
+	sending := tracker == c.sending
+	if wasBlocked != isBlocked {
+		c.tracer.State.SetFlowControlBlocked(c.tracer.Connection, sending, isBlocked)
+	}
+	if newlyBlocked && c.tracer.OnFlowControlBlocked != nil {
+		owner := "remote"
+		if sending {
+			owner = "local"
+		}
+		c.tracer.OnFlowControlBlocked(FlowControlBlockedEvent{
+			Owner:    owner,
+			StreamID: streamID,
+			Limit:    limit,
+		})
+	}
+}
+
+// close unblocks both directions
+func (c *connectionFlowControl) close() {
+	for _, tracker := range []*flowControlTracker{c.sending, c.receiving} {
+		c.update(tracker, func() bool {
+			tracker.connectionBlocked = false
+			clear(tracker.streamLimits)
+			return false
+		}, nil, 0)
+	}
+}
@@ -0,0 +1,312 @@
+package common
+
+import (
+	"fmt"
+	"github.com/quic-go/quic-go/logging"
+	"io"
+	"qperf-go/common/qlog"
+	"qperf-go/common/qlog_app"
+	"strings"
+	"sync"
+	"time"
+)
+
+// textWriter prints reports as a human-readable table, similar to iperf.
+// Apart from reports, only a few milestones and app messages are printed, other events are dropped.
+type textWriter struct {
+	mutex         sync.Mutex
+	w             io.Writer
+	referenceTime time.Time
+	config        *qlog.Config
+	// print bytes and bits per second without metric prefixes
+	printRaw      bool
+	headerPrinted bool
+}
+
+var _ qlog.Writer = &textWriter{}
+
+func NewTextWriter(w io.Writer, printRaw bool, config *qlog.Config) qlog.Writer {
+	return &textWriter{
+		w:             w,
+		referenceTime: time.Now(),
+		config:        config.Populate(),
+		printRaw:      printRaw,
+	}
+}
+
+func (w *textWriter) RecordEvent(details qlog.EventDetails) {
+	w.RecordEventAtTime(time.Now(), details)
+}
+
+func (w *textWriter) ReferenceTime() time.Time {
+	return w.referenceTime
+}
+
+func (w *textWriter) RecordEventAtTime(time time.Time, details qlog.EventDetails) {
+	w.RecordEventWithTimeGroupODCID(details, time, w.config.GroupID, "")
+}
+
+func (w *textWriter) RecordEventAtTimeWithGroup(details qlog.EventDetails, time time.Time, groupID string) {
+	w.RecordEventWithTimeGroupODCID(details, time, groupID, "")
+}
+
+func (w *textWriter) RecordEventWithTimeGroupODCID(details qlog.EventDetails, time time.Time, groupID string, _ string) {
+	if !w.Includes(details.Category(), details.Name()) {
+		return
+	}
+	prefix := ""
+	if groupID != w.config.GroupID {
+		prefix = fmt.Sprintf("[%.8s] ", groupID)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	relativeTime := time.Sub(w.referenceTime)
+	switch ev := details.(type) {
+	case ReportEvent:
+		w.printReport(prefix, "", relativeTime, ev)
+	case *ReportEvent:
+		w.printReport(prefix, "", relativeTime, *ev)
+	case TotalEvent:
+		w.printLine(strings.TrimSpace(strings.Repeat("- ", 45)))
+		w.printReport(prefix, "", relativeTime, ev.ReportEvent)
+		if ev.Remote != nil {
+			w.printReport(prefix, "remote ", relativeTime, *ev.Remote)
+		}
+		w.printVerification(prefix, "", ev.Verification)
+		if ev.Remote != nil {
+			w.printVerification(prefix, "remote ", ev.Remote.Verification)
+		}
+	case HandshakeConfirmedEvent:
+		w.printLine(fmt.Sprintf("%shandshake confirmed after %s", prefix, w.formatDuration(relativeTime)))
+	case FirstAppDataReceivedEvent:
+		w.printLine(fmt.Sprintf("%sfirst byte received after %s", prefix, w.formatDuration(relativeTime)))
+	case TTFBAttemptEvent:
+		w.printTTFBAttempt(prefix, ev)
+	case TTFBSeriesEvent:
+		w.printTTFBSeries(prefix, ev)
+	case ZeroRTTEvent:
+		w.printLine(fmt.Sprintf("%s0-RTT: %d attempted, %d accepted, %d rejected; sent %d packets (%s), received %d packets (%s)",
+			prefix, ev.Attempted, ev.Accepted, ev.Rejected(), ev.PacketsSent, w.formatBytes(ev.BytesSent), ev.PacketsReceived, w.formatBytes(ev.BytesReceived)))
+	case VerificationFailedEvent:
+		w.printLine(fmt.Sprintf("%sverification failed: %s stream %d at offset %d", prefix, ev.Direction, ev.StreamID, ev.Offset))
+	case qlog_app.AppInfoEvent:
+		w.printLine(prefix + ev.Message)
+	case qlog_app.AppErrorEvent:
+		w.printLine(prefix + "error: " + ev.Message)
+	}
+}
+
+func (w *textWriter) printVerification(prefix string, direction string, stats *VerificationStats) {
+	if stats == nil {
+		return
+	}
+	w.printLine(fmt.Sprintf("%s%sverification: %d streams verified, %d failed, %s verified",
+		prefix, direction, stats.StreamsVerified, stats.StreamsFailed, w.formatBytes(logging.ByteCount(stats.BytesVerified))))
+}
+
+func (w *textWriter) printTTFBAttempt(prefix string, ev TTFBAttemptEvent) {
+	var details []string
+	for _, milestone := range []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"handshake_completed", ev.HandshakeCompleted},
+		{"handshake_confirmed", ev.HandshakeConfirmed},
+		{"first_byte_sent", ev.FirstAppDataSent},
+		{"first_byte_received", ev.FirstAppDataReceived},
+	} {
+		if milestone.d != nil {
+			details = append(details, milestone.name+"="+w.formatDuration(*milestone.d))
+		}
+	}
+	w.printLine(fmt.Sprintf("%sattempt %d: %s", prefix, ev.Attempt, strings.Join(details, " ")))
+}
+
+func (w *textWriter) printTTFBSeries(prefix string, ev TTFBSeriesEvent) {
+	w.printLine(strings.TrimSpace(strings.Repeat("- ", 45)))
+	w.printLine(fmt.Sprintf("%s%d attempts", prefix, ev.Attempts))
+	for _, milestone := range []struct {
+		name    string
+		summary LatencySummary
+	}{
+		{"handshake_completed", ev.HandshakeCompleted},
+		{"handshake_confirmed", ev.HandshakeConfirmed},
+		{"first_byte_sent", ev.FirstAppDataSent},
+		{"first_byte_received", ev.FirstAppDataReceived},
+	} {
+		if milestone.summary.Count != 0 {
+			w.printLine(fmt.Sprintf("%s%-20s %s", prefix, milestone.name, w.formatLatencySummary(milestone.summary)))
+		}
+	}
+}
+
+func (w *textWriter) printLine(line string) {
+	_, _ = fmt.Fprintln(w.w, line)
+}
+
+func (w *textWriter) printRow(prefix string, interval string, direction string, bytes logging.ByteCount, megaBitsPerSecond float32, details []string) {
+	if !w.headerPrinted {
+		w.printLine(fmt.Sprintf("%s%-20s %-20s %-14s %-16s %s", strings.Repeat(" ", len(prefix)), "Interval", "Direction", "Transfer", "Bitrate", "Details"))
+		w.headerPrinted = true
+	}
+	w.printLine(strings.TrimRight(fmt.Sprintf("%s%-20s %-20s %-14s %-16s %s", prefix, interval, direction, w.formatBytes(bytes), w.formatBitrate(megaBitsPerSecond), strings.Join(details, " ")), " "))
+}
+
+// printReport prints one row per direction, directionPrefix is prepended to the direction column
+func (w *textWriter) printReport(prefix string, directionPrefix string, relativeTime time.Duration, ev ReportEvent) {
+	interval := fmt.Sprintf("%.2f-%.2f sec", (relativeTime - ev.Period).Seconds(), relativeTime.Seconds())
+	// connection-wide metrics are appended to the first row
+	var details []string
+	if ev.MinRTT != nil {
+		details = append(details, "min_rtt="+w.formatDuration(*ev.MinRTT))
+	}
+	if ev.MaxRTT != nil {
+		details = append(details, "max_rtt="+w.formatDuration(*ev.MaxRTT))
+	}
+	if ev.SmoothedRTT != nil {
+		details = append(details, "srtt="+w.formatDuration(*ev.SmoothedRTT))
+	}
+	if ev.RTTVariance != nil {
+		details = append(details, "rtt_var="+w.formatDuration(*ev.RTTVariance))
+	}
+	if ev.LatestRTT != nil {
+		details = append(details, "latest_rtt="+w.formatDuration(*ev.LatestRTT))
+	}
+	if ev.CongestionWindow != nil {
+		details = append(details, "cwnd="+w.formatByteCountStats(*ev.CongestionWindow))
+	}
+	if ev.BytesInFlight != nil {
+		details = append(details, "in_flight="+w.formatByteCountStats(*ev.BytesInFlight))
+	}
+	if ev.FlowControlBlockedSending != nil {
+		details = append(details, "fc_blocked_send="+w.formatDuration(*ev.FlowControlBlockedSending))
+	}
+	if ev.FlowControlBlockedReceiving != nil {
+		details = append(details, "fc_blocked_recv="+w.formatDuration(*ev.FlowControlBlockedReceiving))
+	}
+	if ev.LimitedBy != nil {
+		details = append(details, "limited_by="+*ev.LimitedBy)
+	}
+	if ev.PacketsReceived != nil {
+		details = append(details, fmt.Sprintf("packets=%d", *ev.PacketsReceived))
+	}
+	if ev.PacketsLost != nil {
+		details = append(details, fmt.Sprintf("lost_packets=%d", *ev.PacketsLost))
+	}
+	row := func(direction string, bytes *logging.ByteCount, megaBitsPerSecond *float32, rowDetails ...string) {
+		if bytes == nil || megaBitsPerSecond == nil {
+			return
+		}
+		w.printRow(prefix, interval, directionPrefix+direction, *bytes, *megaBitsPerSecond, append(details, rowDetails...))
+		details = nil
+	}
+	for _, conn := range ev.Connections {
+		connPrefix := fmt.Sprintf("conn %d ", conn.Connection)
+		row(connPrefix+"recv", conn.StreamBytesReceived, conn.StreamMegaBitsPerSecondReceived)
+		row(connPrefix+"send", conn.StreamBytesSent, conn.StreamMegaBitsPerSecondSent)
+	}
+	var responseDetails []string
+	if ev.ResponsesReceived != nil {
+		responseDetails = append(responseDetails, fmt.Sprintf("responses=%d", *ev.ResponsesReceived))
+	}
+	if ev.RequestLatency != nil && ev.RequestLatency.Count != 0 {
+		responseDetails = append(responseDetails, "latency "+w.formatLatencySummary(*ev.RequestLatency))
+	}
+	if ev.RequestLength != nil && ev.RequestLength.Samples != 0 {
+		responseDetails = append(responseDetails, "request_length="+w.formatByteCountStats(*ev.RequestLength))
+	}
+	if ev.ResponseLength != nil && ev.ResponseLength.Samples != 0 {
+		responseDetails = append(responseDetails, "response_length="+w.formatByteCountStats(*ev.ResponseLength))
+	}
+	if ev.DeadlineExceededResponses != nil {
+		responseDetails = append(responseDetails, fmt.Sprintf("deadline_exceeded=%d", *ev.DeadlineExceededResponses))
+	}
+	row("stream recv", ev.StreamBytesReceived, ev.StreamMegaBitsPerSecondReceived, responseDetails...)
+	row("stream send", ev.StreamBytesSent, ev.StreamMegaBitsPerSecondSent)
+	var datagramDetails []string
+	if ev.DatagramsLost != nil && ev.DatagramsReceived != nil && ev.DatagramLossPercentage != nil {
+		datagramDetails = append(datagramDetails, fmt.Sprintf("lost=%d/%d (%.2f%%)", *ev.DatagramsLost, expectedDatagrams(ev), *ev.DatagramLossPercentage))
+	} else if ev.DatagramsReceived != nil {
+		datagramDetails = append(datagramDetails, fmt.Sprintf("datagrams=%d", *ev.DatagramsReceived))
+	}
+	if ev.DatagramJitter != nil {
+		datagramDetails = append(datagramDetails, "jitter="+w.formatDuration(*ev.DatagramJitter))
+	}
+	if ev.DatagramsOutOfOrder != nil && *ev.DatagramsOutOfOrder != 0 {
+		datagramDetails = append(datagramDetails, fmt.Sprintf("out_of_order=%d", *ev.DatagramsOutOfOrder))
+	}
+	if ev.DatagramsDuplicate != nil && *ev.DatagramsDuplicate != 0 {
+		datagramDetails = append(datagramDetails, fmt.Sprintf("duplicate=%d", *ev.DatagramsDuplicate))
+	}
+	row("datagram recv", ev.DatagramBytesReceived, ev.DatagramMegaBitsPerSecondReceived, datagramDetails...)
+	row("datagram send", ev.DatagramBytesSent, ev.DatagramMegaBitsPerSecondSent)
+}
+
+// expectedDatagrams is the number of datagrams that should have been received, excluding duplicates
+func expectedDatagrams(ev ReportEvent) uint64 {
+	expected := *ev.DatagramsReceived + *ev.DatagramsLost
+	if ev.DatagramsDuplicate != nil {
+		expected -= *ev.DatagramsDuplicate
+	}
+	return expected
+}
+
+func (w *textWriter) formatBytes(bytes logging.ByteCount) string {
+	if w.printRaw {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return formatWithMetricPrefix(float64(bytes), "B")
+}
+
+// formatByteCountStats prints the average followed by the range, e.g. 1.20MB(10.00kB-2.40MB)
+func (w *textWriter) formatByteCountStats(stats ByteCountStats) string {
+	return fmt.Sprintf("%s(%s-%s)", w.formatCompactBytes(stats.Average), w.formatCompactBytes(stats.Min), w.formatCompactBytes(stats.Max))
+}
+
+// formatLatencySummary prints the percentiles followed by the maximum, e.g. p50=1.20ms p90=2.40ms p99=5.00ms p99.9=8.10ms max=9.30ms
+func (w *textWriter) formatLatencySummary(l LatencySummary) string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s p99.9=%s max=%s",
+		w.formatDuration(l.P50), w.formatDuration(l.P90), w.formatDuration(l.P99), w.formatDuration(l.P999), w.formatDuration(l.Max))
+}
+
+func (w *textWriter) formatCompactBytes(bytes logging.ByteCount) string {
+	return strings.ReplaceAll(w.formatBytes(bytes), " ", "")
+}
+
+func (w *textWriter) formatBitrate(megaBitsPerSecond float32) string {
+	if w.printRaw {
+		return fmt.Sprintf("%.0f bit/s", float64(megaBitsPerSecond)*1e6)
+	}
+	return formatWithMetricPrefix(float64(megaBitsPerSecond)*1e6, "bit/s")
+}
+
+func (w *textWriter) formatDuration(d time.Duration) string {
+	if w.printRaw {
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	}
+	return fmt.Sprintf("%.2fms", float64(d.Nanoseconds())/1e6)
+}
+
+// formatWithMetricPrefix uses 10^3 based prefixes, e.g. 12.35 MB
+func formatWithMetricPrefix(value float64, unit string) string {
+	prefixes := []string{"", "k", "M", "G", "T", "P"}
+	i := 0
+	for value >= 1000 && i < len(prefixes)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", value, unit)
+	}
+	return fmt.Sprintf("%.2f %s%s", value, prefixes[i], unit)
+}
+
+func (w *textWriter) Close() {}
+
+func (w *textWriter) Includes(category string, name string) bool {
+	return w.config.Included(category, name)
+}
+
+func (w *textWriter) Config() qlog.Config {
+	return *w.config.Copy()
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"bytes"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTextWriter(&buf, false, nil)
+	bytesReceived := logging.ByteCount(12_345_678)
+	mbpsReceived := float32(98.76)
+	w.RecordEventAtTime(w.ReferenceTime().Add(2*time.Second), ReportEvent{
+		Period:                          time.Second,
+		StreamBytesReceived:             &bytesReceived,
+		StreamMegaBitsPerSecondReceived: &mbpsReceived,
+	})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "Interval"))
+	assert.Equal(t, []string{"1.00-2.00", "sec", "stream", "recv", "12.35", "MB", "98.76", "Mbit/s"}, strings.Fields(lines[1]))
+}
+
+func TestFormatWithMetricPrefix(t *testing.T) {
+	assert.Equal(t, "999 B", formatWithMetricPrefix(999, "B"))
+	assert.Equal(t, "1.00 kB", formatWithMetricPrefix(1000, "B"))
+	assert.Equal(t, "1.50 Gbit/s", formatWithMetricPrefix(1.5e9, "bit/s"))
+}
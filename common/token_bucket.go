@@ -0,0 +1,80 @@
+package common
+
+import (
+	"io"
+	"time"
+)
+
+// MinBurst is the smallest allowed burst size in bytes, the size of a minimal QUIC packet.
+const MinBurst = 1200
+
+// DefaultBurstInterval is used to derive the burst size from the rate, if no burst size is specified.
+const DefaultBurstInterval = 10 * time.Millisecond
+
+// TokenBucket limits the rate of sent bytes.
+// Sending more than the available tokens is allowed, the debt is paid by waiting.
+// Not thread-safe.
+type TokenBucket struct {
+	// in bytes per second
+	rate float64
+	// in bytes
+	burst    uint64
+	tokens   float64
+	lastFill time.Time
+}
+
+// NewTokenBucket creates a full token bucket.
+// bitrate is in bits per second and must not be 0.
+// burst is in bytes, if 0 the amount of bytes sent within DefaultBurstInterval is used.
+func NewTokenBucket(bitrate uint64, burst uint64) *TokenBucket {
+	rate := float64(bitrate) / 8
+	if burst == 0 {
+		burst = uint64(rate * DefaultBurstInterval.Seconds())
+	}
+	burst = Max(burst, MinBurst)
+	return &TokenBucket{
+		rate:     rate,
+		burst:    burst,
+		tokens:   float64(burst),
+		lastFill: time.Now(),
+	}
+}
+
+// Burst returns the burst size in bytes
+func (b *TokenBucket) Burst() uint64 {
+	return b.burst
+}
+
+// Wait blocks until n bytes may be sent.
+func (b *TokenBucket) Wait(n int) {
+	now := time.Now()
+	b.tokens = Min(b.tokens+now.Sub(b.lastFill).Seconds()*b.rate, float64(b.burst))
+	b.lastFill = now
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		time.Sleep(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+}
+
+type pacedReader struct {
+	reader io.Reader
+	bucket *TokenBucket
+}
+
+// NewPacedReader returns a Reader that returns at most burst bytes per read
+// and blocks to not exceed the rate of the token bucket.
+func NewPacedReader(reader io.Reader, bucket *TokenBucket) io.Reader {
+	return &pacedReader{
+		reader: reader,
+		bucket: bucket,
+	}
+}
+
+func (r *pacedReader) Read(p []byte) (n int, err error) {
+	if uint64(len(p)) > r.bucket.Burst() {
+		p = p[:r.bucket.Burst()]
+	}
+	n, err = r.reader.Read(p)
+	r.bucket.Wait(n)
+	return
+}
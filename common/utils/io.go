@@ -2,15 +2,6 @@ package utils
 
 import "io"
 
-type InfiniteReader struct {
-}
-
-var _ io.Reader = InfiniteReader{}
-
-func (i InfiniteReader) Read(p []byte) (n int, err error) {
-	return len(p), nil
-}
-
 type funcToWriterStruct struct {
 	writeFunc func(p []byte) (n int, err error)
 }
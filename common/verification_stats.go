@@ -0,0 +1,42 @@
+package common
+
+import (
+	"github.com/francoispqt/gojay"
+	"slices"
+)
+
+// VerificationStats summarizes the verification of the received payloads
+type VerificationStats struct {
+	// StreamsVerified is the number of completely received streams that matched the pattern
+	StreamsVerified uint64
+	// StreamsFailed is the number of streams with a mismatch
+	StreamsFailed uint64
+	// BytesVerified is the number of payload bytes that matched the pattern, including incomplete streams
+	BytesVerified uint64
+	// FailedStreams are the IDs of the streams with a mismatch
+	FailedStreams []int64
+}
+
+func (s VerificationStats) clone() VerificationStats {
+	s.FailedStreams = slices.Clone(s.FailedStreams)
+	return s
+}
+
+func (s VerificationStats) IsNil() bool { return false }
+func (s VerificationStats) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Uint64Key("streams_verified", s.StreamsVerified)
+	enc.Uint64Key("streams_failed", s.StreamsFailed)
+	enc.Uint64Key("bytes_verified", s.BytesVerified)
+	if len(s.FailedStreams) != 0 {
+		enc.ArrayKey("failed_streams", streamIDs(s.FailedStreams))
+	}
+}
+
+type streamIDs []int64
+
+func (ids streamIDs) IsNil() bool { return ids == nil }
+func (ids streamIDs) MarshalJSONArray(enc *gojay.Encoder) {
+	for _, id := range ids {
+		enc.Int64(id)
+	}
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"github.com/francoispqt/gojay"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// ZeroRTTStats summarizes the early data of the connections
+type ZeroRTTStats struct {
+	PacketsSent     uint64
+	PacketsReceived uint64
+	// sizes of the 0-RTT packets
+	BytesSent     logging.ByteCount
+	BytesReceived logging.ByteCount
+	// Attempted is the number of connections that sent or received 0-RTT packets
+	Attempted uint64
+	// Accepted is the number of connections with quic.ConnectionState.Used0RTT
+	Accepted uint64
+}
+
+// Rejected returns the number of connections that attempted 0-RTT but did not use it
+func (s ZeroRTTStats) Rejected() uint64 {
+	if s.Accepted > s.Attempted {
+		return 0
+	}
+	return s.Attempted - s.Accepted
+}
+
+func (s ZeroRTTStats) IsNil() bool { return false }
+func (s ZeroRTTStats) MarshalJSONObject(enc *gojay.Encoder) {
+	enc.Uint64Key("attempted", s.Attempted)
+	enc.Uint64Key("accepted", s.Accepted)
+	enc.Uint64Key("rejected", s.Rejected())
+	enc.Uint64Key("packets_sent", s.PacketsSent)
+	enc.Uint64Key("packets_received", s.PacketsReceived)
+	enc.Uint64Key("bytes_sent", uint64(s.BytesSent))
+	enc.Uint64Key("bytes_received", uint64(s.BytesReceived))
+}
@@ -5,4 +5,6 @@ import "github.com/quic-go/quic-go"
 const (
 	NoError           = quic.ApplicationErrorCode(0)
 	InternalErrorCode = quic.ApplicationErrorCode(1)
+	// ProtocolErrorCode is used if the peer sent a malformed or unexpected message
+	ProtocolErrorCode = quic.ApplicationErrorCode(2)
 )
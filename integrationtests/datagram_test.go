@@ -0,0 +1,92 @@
+package integrationtests
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"qperf-go/client"
+	"qperf-go/common"
+	"qperf-go/perf"
+	"testing"
+	"time"
+)
+
+func TestSendDatagram(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress: server.Addr().String(),
+		SendDatagram:  true,
+		ProbeTime:     200 * time.Millisecond,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Greater(t, report.SentDatagramBytes, logging.ByteCount(0))
+}
+
+func TestReceiveDatagram(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:   server.Addr().String(),
+		ReceiveDatagram: true,
+		ProbeTime:       200 * time.Millisecond,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Greater(t, report.ReceivedDatagramBytes, logging.ByteCount(0))
+}
+
+func TestInvalidDatagramStopsClientWithError(t *testing.T) {
+	// the server answers with a datagram of an unknown type
+	listener, err := quic.ListenAddr("localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{common.GenerateCert()},
+		NextProtos:   []string{perf.QperfALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second, EnableDatagrams: true})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			_ = conn.SendDatagram([]byte{0xff})
+		}
+	}()
+	client := client.Dial(&client.Config{
+		RemoteAddress:   listener.Addr().String(),
+		ReceiveDatagram: true,
+		ProbeTime:       time.Second,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	select {
+	case <-client.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	assert.ErrorIs(t, client.Err(), perf.ErrInvalidMessage)
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/quic-go/quic-go/logging"
 	"github.com/stretchr/testify/assert"
 	"qperf-go/client"
+	"qperf-go/common"
+	"qperf-go/perf"
 	"testing"
 	"time"
 )
@@ -15,8 +17,8 @@ func BenchmarkBulkData(b *testing.B) {
 	server := newSimpleTestServer(b)
 	client := client.Dial(&client.Config{
 		RemoteAddress:  server.Addr().String(),
-		RequestLength:  uint64(b.N),
-		ResponseLength: uint64(b.N),
+		RequestLength:  common.FixedSize(b.N),
+		ResponseLength: common.FixedSize(b.N),
 		QuicConfig: &quic.Config{
 			MaxIdleTimeout: time.Second,
 		},
@@ -28,7 +30,7 @@ func BenchmarkBulkData(b *testing.B) {
 	<-client.Context().Done()
 	report := client.TotalReport()
 	assert.Equal(b, logging.ByteCount(b.N), report.ReceivedBytes)
-	expectedRequstSize := max(logging.ByteCount(12), logging.ByteCount(b.N)) // minimum request size is 12
+	expectedRequstSize := max(logging.ByteCount(perf.QperfRequestHeaderLength), logging.ByteCount(b.N)) // minimum request size is the header
 	assert.Equal(b, expectedRequstSize, report.SentBytes)
 	b.StopTimer()
 	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds()/1e6*8, "Mbps")
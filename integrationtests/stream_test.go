@@ -7,8 +7,12 @@ import (
 	"github.com/quic-go/quic-go/qlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path"
 	"qperf-go/client"
 	"qperf-go/common"
+	"qperf-go/perf"
 	"qperf-go/perf/perf_server"
 	"qperf-go/server"
 	"testing"
@@ -28,8 +32,9 @@ func newSimpleTestServer(t TestingT) server.Server {
 				Certificates: []tls.Certificate{common.GenerateCert()},
 			},
 			QuicConfig: &quic.Config{
-				MaxIdleTimeout: time.Second,
-				Tracer:         qlog.DefaultConnectionTracer,
+				MaxIdleTimeout:  time.Second,
+				Tracer:          qlog.DefaultConnectionTracer,
+				EnableDatagrams: true,
 			},
 			QlogLabel: "qperf_server",
 		},
@@ -46,8 +51,8 @@ func TestSingleRequest(t *testing.T) {
 	server := newSimpleTestServer(t)
 	client := client.Dial(&client.Config{
 		RemoteAddress:  server.Addr().String(),
-		RequestLength:  100_000,
-		ResponseLength: 100_000,
+		RequestLength:  common.FixedSize(100_000),
+		ResponseLength: common.FixedSize(100_000),
 		NumRequests:    1,
 		QuicConfig: &quic.Config{
 			MaxIdleTimeout:  time.Second,
@@ -69,8 +74,8 @@ func Test1SecProbeTime(t *testing.T) {
 	server := newSimpleTestServer(t)
 	client := client.Dial(&client.Config{
 		RemoteAddress:   server.Addr().String(),
-		RequestLength:   100_000,
-		ResponseLength:  100_000,
+		RequestLength:   common.FixedSize(100_000),
+		ResponseLength:  common.FixedSize(100_000),
 		RequestInterval: time.Second / 10,
 		ProbeTime:       time.Second,
 		QuicConfig: &quic.Config{
@@ -87,3 +92,405 @@ func Test1SecProbeTime(t *testing.T) {
 	assert.Equal(t, logging.ByteCount(1_000_000), report.ReceivedBytes)
 	assert.Equal(t, logging.ByteCount(1_000_000), report.SentBytes)
 }
+
+func TestBitrate(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:      server.Addr().String(),
+		SendInfiniteStream: true,
+		Bitrate:            8_000_000,
+		ProbeTime:          500 * time.Millisecond,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.InDelta(t, 500_000, float64(report.SentBytes), 100_000)
+}
+
+func TestRemoteResults(t *testing.T) {
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:      server.Addr().String(),
+		SendInfiniteStream: true,
+		Bitrate:            8_000_000,
+		ProbeTime:          500 * time.Millisecond,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	results := client.RemoteResults()
+	assert.NotNil(t, results)
+	assert.InDelta(t, float64(report.SentBytes), float64(results.ReceivedStreamBytes), 50_000)
+	assert.Zero(t, results.SentStreamBytes)
+}
+
+func TestParallelStreamsAndConnections(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:         server.Addr().String(),
+		ReceiveInfiniteStream: true,
+		ParallelStreams:       2,
+		Connections:           2,
+		Bitrate:               8_000_000,
+		ProbeTime:             500 * time.Millisecond,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.InDelta(t, 4*500_000, float64(report.ReceivedBytes), 4*100_000)
+}
+
+func TestRequestRate(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:  server.Addr().String(),
+		RequestLength:  common.FixedSize(1_000),
+		ResponseLength: common.FixedSize(10_000),
+		RequestRate:    100,
+		NumRequests:    20,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Equal(t, uint64(20), report.ReceivedResponses)
+	assert.Equal(t, logging.ByteCount(20*10_000), report.ReceivedBytes)
+	assert.Equal(t, uint64(20), report.RequestLatency.Count)
+}
+
+func TestRequestDeadline(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:   server.Addr().String(),
+		RequestLength:   common.FixedSize(1_000_000),
+		ResponseLength:  common.FixedSize(1_000),
+		NumRequests:     1,
+		RequestDeadline: 50 * time.Millisecond,
+		Emulation:       &common.EmulationConfig{Rate: 10_000_000},
+		QuicConfig: &quic.Config{
+			// the request must not be ended by an idle timeout
+			MaxIdleTimeout: 10 * time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	select {
+	case <-client.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	report := client.TotalReport()
+	assert.Equal(t, uint64(1), report.DeadlineExceededResponses)
+	assert.Zero(t, report.ReceivedResponses)
+}
+
+func TestDialErrorStopsClientWithError(t *testing.T) {
+	// the server never answers the handshake
+	packetConn, err := net.ListenPacket("udp", "localhost:0")
+	require.NoError(t, err)
+	defer packetConn.Close()
+	client := client.Dial(&client.Config{
+		RemoteAddress:         packetConn.LocalAddr().String(),
+		ReceiveInfiniteStream: true,
+		ProbeTime:             time.Second,
+		QuicConfig: &quic.Config{
+			HandshakeIdleTimeout: 100 * time.Millisecond,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	select {
+	case <-client.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	var idleTimeoutErr *quic.IdleTimeoutError
+	assert.ErrorAs(t, client.Err(), &idleTimeoutErr)
+}
+
+func TestConcurrency(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:  server.Addr().String(),
+		RequestLength:  common.FixedSize(1_000),
+		ResponseLength: common.FixedSize(10_000),
+		Concurrency:    4,
+		NumRequests:    50,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Equal(t, uint64(50), report.ReceivedResponses)
+	assert.Equal(t, logging.ByteCount(50*10_000), report.ReceivedBytes)
+}
+
+func TestWorkload(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	file := path.Join(t.TempDir(), "workload.csv")
+	require.NoError(t, os.WriteFile(file, []byte("offset,request_bytes,response_bytes,server_delay\n0,100,1000,0\n50,1000,10000,10\n20,10,100,\n"), 0600))
+	workload, err := client.LoadWorkload(file)
+	require.NoError(t, err)
+	require.Len(t, workload, 3)
+	assert.Equal(t, 20*time.Millisecond, workload[1].Offset)
+
+	// JSON files are validated like CSV files
+	jsonFile := path.Join(t.TempDir(), "workload.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`[{"offset":0,"request_bytes":100,"response_bytes":1000},{"offset":20,"request_bytes":10,"response_bytes":100,"server_delay":5}]`), 0600))
+	jsonWorkload, err := client.LoadWorkload(jsonFile)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Millisecond, jsonWorkload[1].ResponseDelay)
+	for _, content := range []string{
+		`[{"offset":-1,"request_bytes":100,"response_bytes":1000}]`,
+		`[{"offset":0,"request_bytes":100,"response_bytes":1000,"server_delay":-1}]`,
+		`[{"offset":0,"request_bytes":100}]`,
+	} {
+		require.NoError(t, os.WriteFile(jsonFile, []byte(content), 0600))
+		_, err := client.LoadWorkload(jsonFile)
+		assert.Error(t, err, content)
+	}
+
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress: server.Addr().String(),
+		Workload:      workload,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Equal(t, uint64(3), report.ReceivedResponses)
+	assert.Equal(t, logging.ByteCount(11_100), report.ReceivedBytes)
+	assert.Equal(t, logging.ByteCount(1_000), report.RequestLength.Max)
+}
+
+func TestTTFBSeries(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	for _, sendInfiniteStream := range []bool{false, true} {
+		client := client.Dial(&client.Config{
+			RemoteAddress:         server.Addr().String(),
+			ReceiveInfiniteStream: true,
+			SendInfiniteStream:    sendInfiniteStream,
+			TimeToFirstByteOnly:   true,
+			Repeat:                3,
+			RepeatInterval:        10 * time.Millisecond,
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		})
+
+		select {
+		case <-client.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		series := client.TTFBSeries()
+		require.NotNil(t, series)
+		assert.Equal(t, 3, series.Attempts, sendInfiniteStream)
+		assert.Equal(t, uint64(3), series.FirstAppDataReceived.Count)
+		assert.LessOrEqual(t, series.HandshakeCompleted.Max, series.FirstAppDataReceived.Max)
+	}
+}
+
+func TestTTFBExcludesControlStream(t *testing.T) {
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:       server.Addr().String(),
+		ResponseLength:      common.FixedSize(1000),
+		ResponseDelay:       100 * time.Millisecond,
+		TimeToFirstByteOnly: true,
+		Repeat:              2,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	select {
+	case <-client.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	series := client.TTFBSeries()
+	require.NotNil(t, series)
+	assert.Equal(t, 2, series.Attempts)
+	// the acknowledgement of the control stream arrives before the delayed response
+	assert.GreaterOrEqual(t, series.FirstAppDataReceived.P50, 100*time.Millisecond)
+}
+
+func TestPersistentSessionCache(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	sessionCachePath := path.Join(t.TempDir(), "sessions")
+	for i := 0; i < 2; i++ {
+		client := client.Dial(&client.Config{
+			RemoteAddress:       server.Addr().String(),
+			TimeToFirstByteOnly: true,
+			Use0RTT:             true,
+			SessionCachePath:    sessionCachePath,
+			ResponseLength:      common.FixedSize(1_000),
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		})
+		<-client.Context().Done()
+		sessionCache, err := common.NewPersistentSessionCache(sessionCachePath)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sessionCache.Len())
+	}
+}
+
+func TestZeroRTTReport(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server, err := server.Listen("localhost:0", &server.Config{
+		PerfConfig: &perf_server.Config{
+			TlsConfig: &tls.Config{
+				Certificates: []tls.Certificate{common.GenerateCert()},
+			},
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout:  time.Second,
+				Tracer:          qlog.DefaultConnectionTracer,
+				EnableDatagrams: true,
+				Allow0RTT:       true,
+			},
+			QlogLabel: "qperf_server",
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close(nil)
+	sessionCachePath := path.Join(t.TempDir(), "sessions")
+	var zeroRTT []common.ZeroRTTStats
+	// the first client stores the session ticket for the second one
+	for i := 0; i < 2; i++ {
+		client := client.Dial(&client.Config{
+			RemoteAddress:       server.Addr().String(),
+			TimeToFirstByteOnly: true,
+			Use0RTT:             true,
+			SessionCachePath:    sessionCachePath,
+			ResponseLength:      common.FixedSize(1_000),
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		})
+		select {
+		case <-client.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		zeroRTT = append(zeroRTT, client.TotalReport().ZeroRTT)
+	}
+	assert.Equal(t, uint64(0), zeroRTT[0].Attempted)
+	assert.Equal(t, uint64(0), zeroRTT[0].PacketsSent)
+	assert.Equal(t, uint64(1), zeroRTT[1].Attempted)
+	assert.Greater(t, zeroRTT[1].PacketsSent, uint64(0))
+	assert.Greater(t, zeroRTT[1].BytesSent, logging.ByteCount(0))
+}
+
+func TestEmulation(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:  server.Addr().String(),
+		RequestLength:  common.FixedSize(10_000),
+		ResponseLength: common.FixedSize(100_000),
+		NumRequests:    1,
+		Emulation:      &common.EmulationConfig{Delay: 10 * time.Millisecond},
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout:  time.Second,
+			EnableDatagrams: true,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Equal(t, logging.ByteCount(100_000), report.ReceivedBytes)
+	require.True(t, report.HasRTT())
+	// both directions are delayed
+	assert.GreaterOrEqual(t, report.MinRTT, 20*time.Millisecond)
+}
+
+func TestVerify(t *testing.T) {
+	//os.Setenv("QLOGDIR", "tmp")
+	server := newSimpleTestServer(t)
+	client := client.Dial(&client.Config{
+		RemoteAddress:  server.Addr().String(),
+		RequestLength:  common.FixedSize(100_000),
+		ResponseLength: common.FixedSize(100_000),
+		NumRequests:    2,
+		Verify:         true,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout:  time.Second,
+			EnableDatagrams: true,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	})
+
+	<-client.Context().Done()
+	report := client.TotalReport()
+	assert.Equal(t, uint64(2), report.Verification.StreamsVerified)
+	assert.Equal(t, uint64(0), report.Verification.StreamsFailed)
+	assert.Equal(t, uint64(200_000), report.Verification.BytesVerified)
+	remote := client.RemoteResults()
+	require.NotNil(t, remote)
+	assert.Equal(t, uint64(2), remote.VerifiedStreams)
+	assert.Equal(t, uint64(2*(100_000-perf.QperfRequestHeaderLength)), remote.VerifiedBytes)
+}
@@ -11,7 +11,7 @@ func Benchmark0RTT(b *testing.B) {
 	writeInitial := false
 	earlySecret := false
 	var key [32]byte
-	_, sessionCache, err := Generate0RttInformation(key, key, "server1", "alpn1")
+	_, sessionCache, err := Generate0RttInformation(key, key, "server1", "alpn1", nil, nil, nil)
 	require.NoError(b, err)
 	conf := &tls.QUICConfig{
 		TLSConfig: &tls.Config{
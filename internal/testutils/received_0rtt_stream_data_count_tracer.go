@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
+	"sync/atomic"
 )
 
 type ZeroRttTracer interface {
@@ -13,12 +14,12 @@ type ZeroRttTracer interface {
 }
 
 type zeroRttTracer struct {
-	receivedBytes int
+	receivedBytes atomic.Int64
 	firstByteChan chan struct{}
 }
 
 func (t *zeroRttTracer) ReceivedBytes() int {
-	return t.receivedBytes
+	return int(t.receivedBytes.Load())
 }
 
 func NewZeroRttTracer() ZeroRttTracer {
@@ -33,12 +34,12 @@ func (t *zeroRttTracer) NewConnectionTracer(_ctx context.Context, _perspective l
 			for _, frame := range frames {
 				switch frame := frame.(type) {
 				case *logging.StreamFrame:
+					t.receivedBytes.Store(int64(frame.Offset + frame.Length))
 					select {
 					case <-t.firstByteChan:
 					default:
 						close(t.firstByteChan)
 					}
-					t.receivedBytes = int(frame.Offset + frame.Length)
 				}
 			}
 		},
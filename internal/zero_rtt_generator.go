@@ -10,15 +10,18 @@ import (
 	"qperf-go/common"
 )
 
-func simpleServerFromKeys(crt tls.Certificate, t *quic.Transport, sessionTicketKey [32]byte, addressTokenKey quic.TokenGeneratorKey, serverName string, alpn string, tracer func(ctx context.Context, perspective logging.Perspective, id quic.ConnectionID) *logging.ConnectionTracer) (*quic.EarlyListener, error) {
+func simpleServerFromKeys(crt tls.Certificate, t *quic.Transport, sessionTicketKey [32]byte, addressTokenKey quic.TokenGeneratorKey, serverName string, alpn string, quicConfig *quic.Config, tracer func(ctx context.Context, perspective logging.Perspective, id quic.ConnectionID) *logging.ConnectionTracer) (*quic.EarlyListener, error) {
 	if t.TokenGeneratorKey != nil {
 		panic("")
 	}
 	t.TokenGeneratorKey = &addressTokenKey
-	quicConfig := &quic.Config{
-		Allow0RTT: true,
-		Tracer:    tracer,
+	if quicConfig == nil {
+		quicConfig = &quic.Config{}
+	} else {
+		quicConfig = quicConfig.Clone()
 	}
+	quicConfig.Allow0RTT = true
+	quicConfig.Tracer = tracer
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{crt},
 		NextProtos:   []string{alpn},
@@ -37,30 +40,55 @@ func simpleServerFromKeys(crt tls.Certificate, t *quic.Transport, sessionTicketK
 
 // Generate0RttInformation generates an address token and a session ticket without opening a connection to actual. server.
 // Allows to make 0-RTT Handshakes without previous connections.
-// The certificate of the servers can be different.
 // SessionTicketKey, addressTokenKey, and ALPN must match on the actual server.
-// TODO transport parameters?
-func Generate0RttInformation(sessionTicketKey [32]byte, addressTokenKey [32]byte, serverName string, alpn string) (quic.TokenStore, tls.ClientSessionCache, error) {
+// The session is stored for serverName, which must be the server name used by the client.
+//
+// The client verifies the certificate of a resumed session with its root CAs,
+// so certificate should be the one of the actual server and rootCAs the pool of the client, nil for the system roots.
+// If certificate is nil, a self-signed certificate is generated, which is only accepted if the client skips verification.
+//
+// quicConfig should match the actual server, 0-RTT is rejected if the server has lower limits than stored in the ticket.
+func Generate0RttInformation(sessionTicketKey [32]byte, addressTokenKey [32]byte, serverName string, alpn string, certificate *tls.Certificate, rootCAs *x509.CertPool, quicConfig *quic.Config) (*common.SingleTokenStore, *common.SingleSessionCache, error) {
 	addr, err := net.ResolveUDPAddr("udp", "[::]:0")
+	if err != nil {
+		return nil, nil, err
+	}
 	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
 	t := quic.Transport{
 		Conn: conn,
 	}
-	keyPair := common.GenerateCertFor([]string{serverName}, nil)
-	listener, err := simpleServerFromKeys(keyPair, &t, sessionTicketKey, addressTokenKey, serverName, alpn, nil)
+	defer t.Close()
+	if certificate == nil {
+		var keyPair tls.Certificate
+		if ip := net.ParseIP(serverName); ip != nil {
+			keyPair = common.GenerateCertFor(nil, []net.IP{ip})
+		} else {
+			keyPair = common.GenerateCertFor([]string{serverName}, nil)
+		}
+		certificate = &keyPair
+		cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		rootCAs = x509.NewCertPool()
+		rootCAs.AddCert(cert)
+	}
+	listener, err := simpleServerFromKeys(*certificate, &t, sessionTicketKey, addressTokenKey, serverName, alpn, quicConfig, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer listener.Close()
 	sessionCache := common.NewSingleSessionCache()
 	tokenStore := common.NewSingleTokenStore()
-	certPool := x509.NewCertPool()
-	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
-	certPool.AddCert(cert)
 	client, err := t.DialEarly(context.Background(), listener.Addr(),
 		&tls.Config{
 			ClientSessionCache: sessionCache,
 			NextProtos:         []string{alpn},
-			RootCAs:            certPool,
+			RootCAs:            rootCAs,
 			ServerName:         serverName,
 		},
 		&quic.Config{
@@ -73,6 +101,5 @@ func Generate0RttInformation(sessionTicketKey [32]byte, addressTokenKey [32]byte
 	sessionCache.Await()
 	tokenStore.Await()
 	client.CloseWithError(0, "")
-	listener.Close()
 	return tokenStore, sessionCache, nil
 }
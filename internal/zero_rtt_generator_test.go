@@ -17,7 +17,12 @@ import (
 func TestGenerate0RttInformation(t *testing.T) {
 	var sessionTicketKey [32]byte
 	var addressTokenKey [32]byte
-	tokenStore, sessionCache, err := Generate0RttInformation(sessionTicketKey, addressTokenKey, "bar", "foo")
+	pair := common.GenerateCertFor([]string{"bar"}, nil)
+	certPool := x509.NewCertPool()
+	crt, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	certPool.AddCert(crt)
+	tokenStore, sessionCache, err := Generate0RttInformation(sessionTicketKey, addressTokenKey, "bar", "foo", &pair, certPool, nil)
 	require.NoError(t, err)
 	addr, err := net.ResolveUDPAddr("udp", "[::]:0")
 	conn, err := net.ListenUDP("udp", addr)
@@ -25,13 +30,8 @@ func TestGenerate0RttInformation(t *testing.T) {
 		Conn: conn,
 	}
 	zeroRttCounter := testutils.NewZeroRttTracer()
-	pair := common.GenerateCert()
-	listener, err := simpleServerFromKeys(pair, &tr, sessionTicketKey, addressTokenKey, "bar", "foo", zeroRttCounter.NewConnectionTracer)
+	listener, err := simpleServerFromKeys(pair, &tr, sessionTicketKey, addressTokenKey, "bar", "foo", nil, zeroRttCounter.NewConnectionTracer)
 	require.NoError(t, err)
-	certPool := x509.NewCertPool()
-	crt, err := x509.ParseCertificate(pair.Certificate[0])
-	require.NoError(t, err)
-	certPool.AddCert(crt)
 	client, err := tr.DialEarly(context.Background(), listener.Addr(),
 		&tls.Config{
 			ClientSessionCache: sessionCache,
@@ -2,19 +2,25 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"github.com/quic-go/quic-go"
 	qlog2 "github.com/quic-go/quic-go/qlog"
 	"github.com/urfave/cli/v2"
+	"math"
 	"net"
 	"os"
 	"qperf-go/client"
 	"qperf-go/common"
 	"qperf-go/common/qlog"
+	"qperf-go/internal"
 	"qperf-go/perf"
+	"qperf-go/perf/perf_server"
 	"qperf-go/server"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,9 +43,72 @@ func clientCommand(config *client.Config) *cli.Command {
 				Name:  "ttfb",
 				Usage: "measure time for connection establishment and first byte only",
 			},
+			&cli.IntFlag{
+				Name:  "repeat",
+				Usage: "measure the time to first byte of this number of fresh connections and report the distributions; with 0rtt, every connection resumes the previous one",
+				Value: 1,
+				Action: func(ctx *cli.Context, i int) error {
+					if !ctx.Bool("ttfb") {
+						return fmt.Errorf("repeat option requires ttfb option")
+					}
+					if i < 1 {
+						return fmt.Errorf("repeat must be at least 1")
+					}
+					config.Repeat = i
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "time between the connections of repeat",
+				Action: func(ctx *cli.Context, d time.Duration) error {
+					if !ctx.IsSet("repeat") {
+						return fmt.Errorf("interval option requires repeat option")
+					}
+					config.RepeatInterval = d
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:        "print-raw",
+				Usage:       "output raw statistics, don't calculate metric prefixes; only applies to the text format",
+				Destination: &config.PrintRaw,
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "output format of stdout: qlog, text or json",
+				Value: common.OutputFormatQlog.String(),
+				Action: func(ctx *cli.Context, s string) error {
+					format, err := common.ParseOutputFormat(s)
+					if err != nil {
+						return err
+					}
+					config.OutputFormat = format
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "csv",
+				Usage: "write every interval report as a row to this CSV file",
+				Action: func(ctx *cli.Context, s string) error {
+					csv, err := common.NewCSVReportWriter(s)
+					if err != nil {
+						return fmt.Errorf("failed to create csv report: %w", err)
+					}
+					config.CSV = csv
+					return nil
+				},
+			},
 			&cli.BoolFlag{
-				Name:  "print-raw",
-				Usage: "output raw statistics, don't calculate metric prefixes",
+				Name:  "json",
+				Usage: "print a single JSON document with config, timings, reports and total when the client exits, instead of streaming events",
+				Action: func(ctx *cli.Context, b bool) error {
+					if ctx.IsSet("format") {
+						return fmt.Errorf("either set json or format")
+					}
+					config.JSONSummary = b
+					return nil
+				},
 			},
 			&cli.UintFlag{
 				Name:  "qlog-queue",
@@ -72,45 +141,22 @@ func clientCommand(config *client.Config) *cli.Command {
 					return nil
 				},
 			},
-			&cli.StringFlag{
-				Name:       "initial-receive-window",
-				Usage:      "the initial stream-level receive window, in bytes (the connection-level window is 1.5 times higher)",
-				Value:      "768KiB",
-				HasBeenSet: true,
-				Action: func(context *cli.Context, s string) error {
-					win, err := common.ParseByteCountWithUnit(s)
-					if err != nil {
-						return fmt.Errorf("failed to parse receive-window: %w", err)
-					}
-					config.QuicConfig.InitialStreamReceiveWindow = win
-					config.QuicConfig.InitialConnectionReceiveWindow = win
-					return nil
-				},
-			},
-			&cli.StringFlag{
-				Name:       "max-receive-window",
-				Usage:      "the maximum stream-level receive window, in bytes (the connection-level window is 1.5 times higher)",
-				Value:      "9MiB",
-				HasBeenSet: true,
-				Action: func(context *cli.Context, s string) error {
-					win, err := common.ParseByteCountWithUnit(s)
-					if err != nil {
-						return fmt.Errorf("failed to parse max-receive-window: %w", err)
-					}
-					config.QuicConfig.MaxStreamReceiveWindow = win
-					config.QuicConfig.MaxConnectionReceiveWindow = win
-					return nil
-				},
-			},
+			initialReceiveWindowFlag(config.QuicConfig, "the initial stream-level receive window, in bytes (the connection-level window is 1.5 times higher)"),
+			maxReceiveWindowFlag(config.QuicConfig, "the maximum stream-level receive window, in bytes (the connection-level window is 1.5 times higher)"),
 			&cli.BoolFlag{
 				Name:  "0rtt",
-				Usage: "gather 0-RTT information to the server beforehand",
+				Usage: "gather 0-RTT information to the server beforehand, or use the ticket of session-cache",
 				Value: false,
 				Action: func(context *cli.Context, b bool) error {
 					config.Use0RTT = b
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:        "session-cache",
+				Usage:       "load and store TLS session tickets in this file, to resume sessions and use 0-RTT across runs without a warm-up connection",
+				Destination: &config.SessionCachePath,
+			},
 			&cli.BoolFlag{
 				Name:  "receive-stream",
 				Usage: "stream data from server. Disable by --receive-stream=0",
@@ -146,13 +192,28 @@ func clientCommand(config *client.Config) *cli.Command {
 			},
 			&cli.BoolFlag{
 				Name:  "receive-datagram",
-				Usage: "receive datagrams to server",
+				Usage: "receive datagrams from server",
 				Value: false,
 				Action: func(context *cli.Context, b bool) error {
 					config.ReceiveDatagram = b
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:  "datagram-size",
+				Usage: fmt.Sprintf("size of payload datagrams sent by client and server, in bytes; reduced if not allowed by the connection (default: %d)", perf.DefaultDatagramSize),
+				Action: func(ctx *cli.Context, s string) error {
+					size, err := common.ParseByteCountWithUnit(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse datagram-size: %w", err)
+					}
+					if size < perf.DatagramPayloadHeaderLength {
+						return fmt.Errorf("datagram-size must be at least %d bytes", perf.DatagramPayloadHeaderLength)
+					}
+					config.DatagramSize = size
+					return nil
+				},
+			},
 			&cli.BoolFlag{
 				Name: "tls-skip-verify",
 				Aliases: []string{
@@ -189,6 +250,88 @@ func clientCommand(config *client.Config) *cli.Command {
 					return nil
 				},
 			},
+			&cli.BoolFlag{
+				Name:  "min-rtt",
+				Usage: "include the minimum RTT in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportMinRTT = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "srtt",
+				Usage: "include the smoothed RTT in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportSmoothedRTT = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "rtt-var",
+				Usage: "include the RTT variance in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportRTTVariance = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "latest-rtt",
+				Usage: "include the latest RTT sample in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportLatestRTT = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "packets",
+				Usage: "include the number of received packets in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportPacketsReceived = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "cwnd",
+				Usage: "include the congestion window and bytes in flight in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportCongestionMetrics = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "flow-control",
+				Usage: "include the time blocked by flow control and what limited the throughput in the reports",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					config.ReportFlowControl = b
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "all-metrics",
+				Usage: "include all optional metrics in the reports, i.e. packet loss, packets, min, max, smoothed, latest RTT, RTT variance, congestion window, bytes in flight and flow control",
+				Value: false,
+				Action: func(context *cli.Context, b bool) error {
+					if b {
+						config.ReportLostPackets = true
+						config.ReportPacketsReceived = true
+						config.ReportMinRTT = true
+						config.ReportMaxRTT = true
+						config.ReportSmoothedRTT = true
+						config.ReportRTTVariance = true
+						config.ReportLatestRTT = true
+						config.ReportCongestionMetrics = true
+						config.ReportFlowControl = true
+					}
+					return nil
+				},
+			},
 			&cli.BoolFlag{
 				Name: "reconnect",
 				Aliases: []string{
@@ -212,21 +355,115 @@ func clientCommand(config *client.Config) *cli.Command {
 					return nil
 				},
 			},
-			&cli.Uint64Flag{
+			&cli.StringFlag{
 				Name:  "request-length",
-				Usage: "bytes sent per stream request",
-				Value: 0,
-				Action: func(context *cli.Context, v uint64) error {
-					config.RequestLength = v
+				Usage: "bytes sent per stream request, either fixed like 64KiB or a distribution: uniform(min,max), exponential(mean), lognormal(mu,sigma) of the natural logarithm or cdf(path) with lines of size and cumulative probability",
+				Action: func(context *cli.Context, s string) error {
+					distribution, err := common.ParseSizeDistribution(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse request-length: %w", err)
+					}
+					config.RequestLength = distribution
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:  "workload",
+				Usage: "replay the requests of a CSV or JSON file with the columns offset, request_bytes, response_bytes and server_delay, times in ms",
+				Action: func(ctx *cli.Context, s string) error {
+					for _, conflicting := range []string{"request-length", "response-length", "request-interval", "rate", "concurrency"} {
+						if ctx.IsSet(conflicting) {
+							return fmt.Errorf("either set workload or %s", conflicting)
+						}
+					}
+					workload, err := client.LoadWorkload(s)
+					if err != nil {
+						return fmt.Errorf("failed to load workload: %w", err)
+					}
+					config.Workload = workload
+					return nil
+				},
+			},
+			&cli.Uint64Flag{
+				Name:        "seed",
+				Usage:       "seed of the random number generator that samples request and response lengths and poisson arrivals",
+				Destination: &config.Seed,
+			},
 			&cli.DurationFlag{
 				Name:        "request-interval",
 				Usage:       "time after which a new request is sent",
 				Value:       0,
 				Destination: &config.RequestInterval,
 			},
+			&cli.StringFlag{
+				Name:  "rate",
+				Usage: "start requests at this rate, e.g. 100/s, independent of the completion of previous requests (open loop)",
+				Action: func(ctx *cli.Context, s string) error {
+					if ctx.IsSet("request-interval") {
+						return fmt.Errorf("either set rate or request-interval")
+					}
+					rate, err := strconv.ParseFloat(strings.TrimSuffix(s, "/s"), 64)
+					if err != nil {
+						return fmt.Errorf("failed to parse rate: %w", err)
+					}
+					if rate <= 0 {
+						return fmt.Errorf("rate must be positive")
+					}
+					config.RequestRate = rate
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "arrival",
+				Usage: "distribution of the times between the requests of rate: fixed or poisson",
+				Value: "fixed",
+				Action: func(ctx *cli.Context, s string) error {
+					if !ctx.IsSet("rate") {
+						return fmt.Errorf("arrival option requires rate option")
+					}
+					switch s {
+					case "fixed":
+						config.PoissonArrivals = false
+					case "poisson":
+						config.PoissonArrivals = true
+					default:
+						return fmt.Errorf("unknown arrival distribution %s", s)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:  "max-in-flight",
+				Usage: "maximum number of outstanding requests of rate, further requests are delayed; 0 for unlimited",
+				Value: client.DefaultMaxInFlight,
+				Action: func(ctx *cli.Context, i int) error {
+					if !ctx.IsSet("rate") {
+						return fmt.Errorf("max-in-flight option requires rate option")
+					}
+					if i < 0 {
+						return fmt.Errorf("max-in-flight must not be negative")
+					}
+					if i == 0 {
+						i = -1 // unlimited
+					}
+					config.MaxInFlight = i
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "number of outstanding requests, a new request is started when one is completed (closed loop)",
+				Action: func(ctx *cli.Context, i int) error {
+					if ctx.IsSet("rate") || ctx.IsSet("request-interval") {
+						return fmt.Errorf("either set concurrency or rate or request-interval")
+					}
+					if i < 1 {
+						return fmt.Errorf("concurrency must be at least 1")
+					}
+					config.Concurrency = i
+					return nil
+				},
+			},
 			&cli.Uint64Flag{
 				Name: "request-number",
 				Aliases: []string{
@@ -239,12 +476,20 @@ func clientCommand(config *client.Config) *cli.Command {
 					return nil
 				},
 			},
-			&cli.Uint64Flag{
+			&cli.BoolFlag{
+				Name:        "request-events",
+				Usage:       "record an event with stream ID, sizes and latency for every completed request",
+				Destination: &config.RequestEvents,
+			},
+			&cli.StringFlag{
 				Name:  "response-length",
-				Usage: "bytes received per stream response",
-				Value: 0,
-				Action: func(context *cli.Context, v uint64) error {
-					config.ResponseLength = v
+				Usage: "bytes received per stream response, either fixed like 64KiB or a distribution: uniform(min,max), exponential(mean), lognormal(mu,sigma) of the natural logarithm or cdf(path) with lines of size and cumulative probability",
+				Action: func(context *cli.Context, s string) error {
+					distribution, err := common.ParseSizeDistribution(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse response-length: %w", err)
+					}
+					config.ResponseLength = distribution
 					return nil
 				},
 			},
@@ -266,6 +511,105 @@ func clientCommand(config *client.Config) *cli.Command {
 				Value:       client.DefaultDeadline,
 				Destination: &config.RequestDeadline,
 			},
+			&cli.IntFlag{
+				Name:    "parallel-streams",
+				Aliases: []string{"P"},
+				Usage:   "number of parallel infinite streams per direction and connection",
+				Value:   1,
+				Action: func(ctx *cli.Context, i int) error {
+					if i < 1 {
+						return fmt.Errorf("parallel-streams must be at least 1")
+					}
+					config.ParallelStreams = i
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:    "connections",
+				Aliases: []string{"c"},
+				Usage:   "number of parallel connections",
+				Value:   1,
+				Action: func(ctx *cli.Context, i int) error {
+					if i < 1 {
+						return fmt.Errorf("connections must be at least 1")
+					}
+					config.Connections = i
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:    "bitrate",
+				Aliases: []string{"b"},
+				Usage:   "target bitrate of every sending stream and datagram flow, e.g. 50Mbit; unlimited if not set",
+				Action: func(ctx *cli.Context, s string) error {
+					bitrate, err := common.ParseBitrateWithUnit(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse bitrate: %w", err)
+					}
+					config.Bitrate = bitrate
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "burst",
+				Usage: fmt.Sprintf("burst size of the pacer in bytes, e.g. 64KiB; defaults to the bytes sent within %s", common.DefaultBurstInterval),
+				Action: func(ctx *cli.Context, s string) error {
+					if !ctx.IsSet("bitrate") {
+						return fmt.Errorf("burst option requires bitrate option")
+					}
+					burst, err := common.ParseByteCountWithUnit(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse burst: %w", err)
+					}
+					if burst > math.MaxUint32 {
+						return fmt.Errorf("burst must not exceed %d bytes", uint32(math.MaxUint32))
+					}
+					config.Burst = burst
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "emulate",
+				Usage: "emulate a network link in both directions, e.g. \"delay=20ms,loss=1%,rate=50Mbit\";\nkeys: delay, jitter, loss, gemodel=p/r[/1-h/1-k], reorder, duplicate, rate, limit, seed",
+				Action: func(ctx *cli.Context, s string) error {
+					emulation, err := common.ParseEmulationConfig(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse emulate: %w", err)
+					}
+					config.Emulation = emulation
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:        "verify",
+				Usage:       "send a pseudo-random pattern on all streams and verify it at both ends, to detect corrupted or reordered data",
+				Destination: &config.Verify,
+			},
+			&cli.StringFlag{
+				Name:  "payload",
+				Usage: "payload of request streams: zeros, random, pattern:<text>, pattern:0x<hex> or file:<path> to repeat the content of the file",
+				Action: func(ctx *cli.Context, s string) error {
+					if ctx.Bool("verify") {
+						return fmt.Errorf("either set verify or payload")
+					}
+					payload, err := perf.ParsePayload(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse payload: %w", err)
+					}
+					config.Payload = payload
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "draft",
+				Usage: "use the wire format of draft-banks-quic-performance (ALPN perf) to test other perf servers;\nresponse delays, bitrates, datagrams, verification and remote results are not available",
+				Action: func(ctx *cli.Context, b bool) error {
+					if b {
+						config.TlsConfig.NextProtos = []string{perf.ALPN}
+					}
+					return nil
+				},
+			},
 			&cli.BoolFlag{
 				Name:  "gso",
 				Usage: "enable generic segmentation offload",
@@ -290,17 +634,26 @@ func clientCommand(config *client.Config) *cli.Command {
 				!config.SendInfiniteStream &&
 				!config.ReceiveDatagram &&
 				!config.SendDatagram &&
-				config.RequestLength == 0 &&
-				config.ResponseLength == 0 {
+				config.RequestLength == nil &&
+				config.ResponseLength == nil &&
+				len(config.Workload) == 0 {
 				config.ReceiveInfiniteStream = true // receive stream if nothing else is specified
 			}
 
+			if c.Bool("draft") && (config.ReceiveDatagram || config.SendDatagram || config.ResponseDelay != 0 || config.Bitrate != 0 || config.Verify) {
+				return fmt.Errorf("draft option does not support datagrams, response-delay, bitrate and verify")
+			}
+
+			if (config.RequestRate != 0 || config.Concurrency != 0) && config.RequestLength == nil && config.ResponseLength == nil {
+				return fmt.Errorf("rate and concurrency options require request-length or response-length option")
+			}
+
 			if config.ProbeTime == 0 {
 				if config.ReceiveInfiniteStream ||
 					config.SendInfiniteStream ||
 					config.ReceiveDatagram ||
 					config.SendDatagram ||
-					(config.RequestInterval != 0 && config.NumRequests == 0) {
+					((config.RequestInterval != 0 || config.RequestRate != 0 || config.Concurrency != 0) && config.NumRequests == 0) {
 					config.ProbeTime = client.DefaultProbeTime
 				} else {
 					config.ProbeTime = client.MaxProbeTime // stop after transaction not after time
@@ -314,7 +667,7 @@ func clientCommand(config *client.Config) *cli.Command {
 			config.TimeToFirstByteOnly = c.Bool("ttfb")
 			client := client.Dial(config)
 			<-client.Context().Done()
-			return nil
+			return client.Err()
 		},
 	}
 }
@@ -334,64 +687,49 @@ func serverCommand(config *server.Config) *cli.Command {
 				Usage: "port to listen on",
 				Value: perf.DefaultServerPort,
 			},
-			&cli.UintFlag{
-				Name:  "qlog-queue",
-				Usage: "set size of the qlog event in-memory queue",
-				Value: qlog.DefaultMemoryQueueSize,
-				Action: func(context *cli.Context, i uint) error {
-					config.QlogConfig.MemoryQueueSize = int(i)
-					return nil
-				},
-			},
-			&cli.StringFlag{
-				Name:  "tls-cert",
-				Usage: "certificate file to use",
+			&cli.BoolFlag{
+				Name:        "print-raw",
+				Usage:       "output raw statistics, don't calculate metric prefixes; only applies to the text format",
+				Destination: &config.PrintRaw,
 			},
 			&cli.StringFlag{
-				Name:  "tls-key",
-				Usage: "key file to use",
+				Name:  "format",
+				Usage: "output format of stdout: qlog, text or json",
+				Value: common.OutputFormatQlog.String(),
 				Action: func(ctx *cli.Context, s string) error {
-					if !ctx.IsSet("tls-cert") {
-						return fmt.Errorf("-tls-cert must also be set")
-					}
-					cert, err := tls.LoadX509KeyPair(ctx.String("tls-cert"), s)
+					format, err := common.ParseOutputFormat(s)
 					if err != nil {
 						return err
 					}
-					config.PerfConfig.TlsConfig.Certificates = []tls.Certificate{cert}
+					config.OutputFormat = format
 					return nil
 				},
 			},
-			&cli.StringFlag{
-				Name:       "initial-receive-window",
-				Usage:      "the initial stream-level receive window, in bytes (the connection-level window is 1.5 times higher)",
-				Value:      "768KiB",
-				HasBeenSet: true,
-				Action: func(context *cli.Context, s string) error {
-					win, err := common.ParseByteCountWithUnit(s)
-					if err != nil {
-						return fmt.Errorf("failed to parse receive-window: %w", err)
-					}
-					config.PerfConfig.QuicConfig.InitialStreamReceiveWindow = win
-					config.PerfConfig.QuicConfig.InitialConnectionReceiveWindow = win
+			&cli.UintFlag{
+				Name:  "qlog-queue",
+				Usage: "set size of the qlog event in-memory queue",
+				Value: qlog.DefaultMemoryQueueSize,
+				Action: func(context *cli.Context, i uint) error {
+					config.QlogConfig.MemoryQueueSize = int(i)
 					return nil
 				},
 			},
+			&cli.DurationFlag{
+				Name:        "report-interval",
+				Aliases:     []string{"i"},
+				Usage:       "seconds between each statistics report of every connection",
+				Value:       server.DefaultReportInterval,
+				Destination: &config.ReportInterval,
+			},
 			&cli.StringFlag{
-				Name:       "max-receive-window",
-				Usage:      "the maximum stream-level receive window, in bytes (the connection-level window is 1.5 times higher)",
-				Value:      "9MiB",
-				HasBeenSet: true,
-				Action: func(context *cli.Context, s string) error {
-					win, err := common.ParseByteCountWithUnit(s)
-					if err != nil {
-						return fmt.Errorf("failed to parse max-receive-window: %w", err)
-					}
-					config.PerfConfig.QuicConfig.MaxStreamReceiveWindow = win
-					config.PerfConfig.QuicConfig.MaxConnectionReceiveWindow = win
-					return nil
-				},
+				Name:  "tls-cert",
+				Usage: "certificate file to use",
 			},
+			tlsKeyFlag("key file to use", func(cert tls.Certificate) {
+				config.PerfConfig.TlsConfig.Certificates = []tls.Certificate{cert}
+			}),
+			initialReceiveWindowFlag(config.PerfConfig.QuicConfig, "the initial stream-level receive window, in bytes (the connection-level window is 1.5 times higher)"),
+			maxReceiveWindowFlag(config.PerfConfig.QuicConfig, "the maximum stream-level receive window, in bytes (the connection-level window is 1.5 times higher)"),
 			&cli.BoolFlag{
 				Name:       "0rtt-state-request",
 				Usage:      "use 0-rtt connection for requests to state server",
@@ -407,15 +745,11 @@ func serverCommand(config *server.Config) *cli.Command {
 				Usage: "TLS session ticket key used for 0-RTT; value must be 32 byte and base64 encoded; if not set a random key is generated",
 				Value: "",
 				Action: func(ctx *cli.Context, s string) error {
-					key, err := base64.StdEncoding.DecodeString(s)
+					key, err := parseKey(s, "session ticket key")
 					if err != nil {
-						return fmt.Errorf("failed to parse session ticket key: %s", err)
-					}
-					if len(key) != 32 {
-						return fmt.Errorf("failed to parse session ticket key: must be 32 byte")
+						return err
 					}
-					array := ([32]byte)(key)
-					config.SessionTicketKey = &array
+					config.SessionTicketKey = &key
 					return nil
 				},
 			},
@@ -424,14 +758,11 @@ func serverCommand(config *server.Config) *cli.Command {
 				Usage: "QUIC address token key used for 0-RTT; value must be 32 byte and base64 encoded; if not set a random key is generated",
 				Value: "",
 				Action: func(ctx *cli.Context, s string) error {
-					key, err := base64.StdEncoding.DecodeString(s)
+					key, err := parseKey(s, "address token key")
 					if err != nil {
-						return fmt.Errorf("failed to parse session ticket key: %s", err)
-					}
-					if len(key) != 32 {
-						return fmt.Errorf("failed to parse session ticket key: must be 32 byte")
+						return err
 					}
-					config.AddressTokenKey = (*quic.TokenGeneratorKey)(key)
+					config.AddressTokenKey = (*quic.TokenGeneratorKey)(&key)
 					return nil
 				},
 			},
@@ -439,14 +770,11 @@ func serverCommand(config *server.Config) *cli.Command {
 				Name:  "stateless-reset-key",
 				Usage: "Key used to generate stateless resets tokens; value must be 32 byte and base64 encoded; if not set stateless reset is disabled",
 				Action: func(ctx *cli.Context, s string) error {
-					key, err := base64.StdEncoding.DecodeString(s)
+					key, err := parseKey(s, "stateless reset key")
 					if err != nil {
-						return fmt.Errorf("failed to parse stateless reset key: %s", err)
-					}
-					if len(key) != 32 {
-						return fmt.Errorf("failed to parse stateless reset key: must be 32 byte")
+						return err
 					}
-					config.StatelessResetKey = (*quic.StatelessResetKey)(key)
+					config.StatelessResetKey = (*quic.StatelessResetKey)(&key)
 					return nil
 				},
 			},
@@ -454,14 +782,11 @@ func serverCommand(config *server.Config) *cli.Command {
 				Name:  "router-key",
 				Usage: "Key used for connection id routing; value must be 32 byte and base64 encoded; if not set connection id routing is disabled",
 				Action: func(ctx *cli.Context, s string) error {
-					key, err := base64.StdEncoding.DecodeString(s)
+					key, err := parseKey(s, "router key")
 					if err != nil {
-						return fmt.Errorf("failed to parse stateless reset key: %s", err)
-					}
-					if len(key) != 32 {
-						return fmt.Errorf("failed to parse stateless reset key: must be 32 byte")
+						return err
 					}
-					config.RouterKey = (*[32]byte)(key)
+					config.RouterKey = &key
 					return nil
 				},
 			},
@@ -486,6 +811,30 @@ func serverCommand(config *server.Config) *cli.Command {
 					return nil
 				},
 			},
+			&cli.StringFlag{
+				Name:  "emulate",
+				Usage: "emulate a network link in both directions, e.g. \"delay=20ms,loss=1%,rate=50Mbit\";\nkeys: delay, jitter, loss, gemodel=p/r[/1-h/1-k], reorder, duplicate, rate, limit, seed",
+				Action: func(ctx *cli.Context, s string) error {
+					emulation, err := common.ParseEmulationConfig(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse emulate: %w", err)
+					}
+					config.Emulation = emulation
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "payload",
+				Usage: "payload of response streams: zeros, random, pattern:<text>, pattern:0x<hex> or file:<path> to repeat the content of the file",
+				Action: func(ctx *cli.Context, s string) error {
+					payload, err := perf.ParsePayload(s)
+					if err != nil {
+						return fmt.Errorf("failed to parse payload: %w", err)
+					}
+					config.PerfConfig.Payload = payload
+					return nil
+				},
+			},
 			&cli.BoolFlag{
 				Name:  "gso",
 				Usage: "enable generic segmentation offload",
@@ -541,9 +890,7 @@ func serverCommand(config *server.Config) *cli.Command {
 				config.PerfConfig.TlsConfig.Certificates = []tls.Certificate{common.GenerateCert()}
 			}
 
-			win := common.Max(config.PerfConfig.QuicConfig.InitialStreamReceiveWindow, config.PerfConfig.QuicConfig.MaxStreamReceiveWindow)
-			config.PerfConfig.QuicConfig.MaxStreamReceiveWindow = win
-			config.PerfConfig.QuicConfig.MaxConnectionReceiveWindow = win
+			raiseMaxReceiveWindow(config.PerfConfig.QuicConfig)
 
 			qlogLabel := c.String("log-label")
 			config.PerfConfig.QuicConfig.Tracer = qlog2.DefaultConnectionTracer
@@ -563,6 +910,173 @@ func serverCommand(config *server.Config) *cli.Command {
 	}
 }
 
+func generate0RttCommand() *cli.Command {
+	var sessionTicketKey [32]byte
+	var certificate *tls.Certificate
+	var certPool *x509.CertPool
+	quicConfig := (&perf_server.Config{}).Populate().QuicConfig
+	return &cli.Command{
+		Name:  "generate-0rtt",
+		Usage: "generate a session ticket offline, for 0-RTT in the first connection of a client",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "remote-addr",
+				Aliases:  []string{"a"},
+				Usage:    fmt.Sprintf("address of the server, as passed to the client, default port %d if not specified.", perf.DefaultServerPort),
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "session-ticket-key",
+				Usage:    "TLS session ticket key of the server; value must be 32 byte and base64 encoded",
+				Required: true,
+				Action: func(ctx *cli.Context, s string) error {
+					var err error
+					sessionTicketKey, err = parseKey(s, "session ticket key")
+					return err
+				},
+			},
+			&cli.StringFlag{
+				Name:     "session-cache",
+				Usage:    "file to store the session ticket in, to be passed to the client",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "tls-cert",
+				Usage: "certificate file of the server; if not set, a self signed certificate is used, which requires the client to skip verification",
+			},
+			tlsKeyFlag("key file of the server", func(cert tls.Certificate) {
+				certificate = &cert
+			}),
+			&cli.StringSliceFlag{
+				Name:  "cert-pool",
+				Usage: "certificate files trusted by the client",
+				Action: func(context *cli.Context, paths []string) error {
+					certPool = common.NewCertPoolFromFiles(paths...)
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "draft",
+				Usage: "generate the state for clients using the draft option",
+			},
+			initialReceiveWindowFlag(quicConfig, "the initial stream-level receive window of the server, in bytes"),
+			maxReceiveWindowFlag(quicConfig, "the maximum stream-level receive window of the server, in bytes"),
+			&cli.IntFlag{
+				Name:  "max-incoming-streams",
+				Usage: "maximum allowed number of incoming streams of the server",
+				Action: func(ctx *cli.Context, i int) error {
+					quicConfig.MaxIncomingStreams = int64(i)
+					return nil
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.IsSet("tls-cert") && certificate == nil {
+				return fmt.Errorf("-tls-key must also be set")
+			}
+			raiseMaxReceiveWindow(quicConfig)
+
+			// the client uses the IP address as server name, which is the key of the session cache
+			addr, err := net.ResolveUDPAddr("udp", common.AppendPortIfNotSpecified(c.String("remote-addr"), perf.DefaultServerPort))
+			if err != nil {
+				return err
+			}
+			serverName := addr.IP.String()
+
+			alpn := perf.QperfALPN
+			if c.Bool("draft") {
+				alpn = perf.ALPN
+			}
+			// address tokens cannot be stored, the key of the generated token does not matter
+			_, sessionCache, err := internal.Generate0RttInformation(sessionTicketKey, [32]byte{}, serverName, alpn, certificate, certPool, quicConfig)
+			if err != nil {
+				return fmt.Errorf("failed to generate 0-RTT information: %w", err)
+			}
+			persistentSessionCache, err := common.NewPersistentSessionCache(c.String("session-cache"))
+			if err != nil {
+				return err
+			}
+			persistentSessionCache.Put(sessionCache.Await())
+			fmt.Printf("stored 0-RTT information for %s\n", serverName)
+			return nil
+		},
+	}
+}
+
+// tlsKeyFlag loads the key pair of the tls-cert flag and the tls-key flag
+func tlsKeyFlag(usage string, setCertificate func(cert tls.Certificate)) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "tls-key",
+		Usage: usage,
+		Action: func(ctx *cli.Context, s string) error {
+			if !ctx.IsSet("tls-cert") {
+				return fmt.Errorf("-tls-cert must also be set")
+			}
+			cert, err := tls.LoadX509KeyPair(ctx.String("tls-cert"), s)
+			if err != nil {
+				return err
+			}
+			setCertificate(cert)
+			return nil
+		},
+	}
+}
+
+func initialReceiveWindowFlag(quicConfig *quic.Config, usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:       "initial-receive-window",
+		Usage:      usage,
+		Value:      "768KiB",
+		HasBeenSet: true,
+		Action: func(context *cli.Context, s string) error {
+			win, err := common.ParseByteCountWithUnit(s)
+			if err != nil {
+				return fmt.Errorf("failed to parse receive-window: %w", err)
+			}
+			quicConfig.InitialStreamReceiveWindow = win
+			quicConfig.InitialConnectionReceiveWindow = win
+			return nil
+		},
+	}
+}
+
+func maxReceiveWindowFlag(quicConfig *quic.Config, usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:       "max-receive-window",
+		Usage:      usage,
+		Value:      "9MiB",
+		HasBeenSet: true,
+		Action: func(context *cli.Context, s string) error {
+			win, err := common.ParseByteCountWithUnit(s)
+			if err != nil {
+				return fmt.Errorf("failed to parse max-receive-window: %w", err)
+			}
+			quicConfig.MaxStreamReceiveWindow = win
+			quicConfig.MaxConnectionReceiveWindow = win
+			return nil
+		},
+	}
+}
+
+// raiseMaxReceiveWindow raises the maximum receive windows of a server to the initial stream-level receive window
+func raiseMaxReceiveWindow(quicConfig *quic.Config) {
+	win := common.Max(quicConfig.InitialStreamReceiveWindow, quicConfig.MaxStreamReceiveWindow)
+	quicConfig.MaxStreamReceiveWindow = win
+	quicConfig.MaxConnectionReceiveWindow = win
+}
+
+// parseKey decodes a base64 encoded 32 byte key, name is used in the error
+func parseKey(s string, name string) ([32]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("failed to parse %s: %s", name, err)
+	}
+	if len(key) != 32 {
+		return [32]byte{}, fmt.Errorf("failed to parse %s: must be 32 byte", name)
+	}
+	return [32]byte(key), nil
+}
+
 func main() {
 	clientConfig := (&client.Config{}).Populate()
 	serverConfig := (&server.Config{}).Populate()
@@ -598,14 +1112,16 @@ func main() {
 		Commands: []*cli.Command{
 			clientCommand(clientConfig),
 			serverCommand(serverConfig),
+			generate0RttCommand(),
 		},
 	}
 
 	err := app.Run(os.Args)
-	if err != nil {
-		panic(err)
-	}
 	for _, d := range doOnStop {
 		d()
 	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,320 @@
+package perf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"io"
+	"time"
+)
+
+// The control stream is the first client-initiated bidirectional stream, only used with QperfALPN.
+// The client sends a TestDescription, the server responds with a TestAcknowledgement.
+// Every message consists of the MessageType (1 byte), the length of the payload (varint) and the payload.
+//
+// The payload of a TestDescription is the version (varint), followed by parameters,
+// each encoded as type (varint), length of the value (varint) and value.
+// The payload of a TestAcknowledgement is the version (varint), the ControlErrorCode (varint) and the reason (remaining bytes).
+
+// ControlStreamID is the ID of the control stream
+const ControlStreamID quic.StreamID = 0
+
+// ControlProtocolVersion is the version sent by the client
+const ControlProtocolVersion uint64 = 1
+
+// SupportedControlProtocolVersions are accepted by the server, the highest version first
+var SupportedControlProtocolVersions = []uint64{ControlProtocolVersion}
+
+// ControlStreamTimeout is the time after which the server uses the default parameters
+// if it has not received a test description
+const ControlStreamTimeout = time.Second
+
+// TestEndGracePeriod is the time after the Duration of the test after which the server closes the connection,
+// it leaves time to request the results
+const TestEndGracePeriod = 2 * time.Second
+
+// MaxControlMessageLength is the maximum length of the payload of control messages
+const MaxControlMessageLength = 4096
+
+var ErrInvalidControlMessage = errors.New("invalid control message")
+
+// ParameterType identifies a parameter of the TestDescription.
+// The server rejects tests with unknown critical parameters, other unknown parameters are ignored.
+type ParameterType uint64
+
+const (
+	// ParameterBitrate is the bitrate of the test in bits per second, see RequestHeader
+	ParameterBitrate ParameterType = 0x01
+	// ParameterDuration is the duration of the test in milliseconds
+	ParameterDuration ParameterType = 0x02
+	// ParameterBurst is the burst size of the pacer in bytes
+	ParameterBurst ParameterType = 0x03
+	// ParameterDatagramSize is the size of the payload datagrams sent by the server in bytes
+	ParameterDatagramSize ParameterType = 0x05
+	// ParameterDirection is the Direction of the test
+	ParameterDirection ParameterType = 0x06
+	// ParameterVerify is 1 if the payload of streams is verified, see NewPatternReader
+	ParameterVerify ParameterType = 0x07
+)
+
+// Critical returns true for odd types, which must be supported by the server
+func (t ParameterType) Critical() bool {
+	return t&1 == 1
+}
+
+// Direction is a bitmask of the directions in which data is sent
+type Direction uint64
+
+const (
+	// DirectionUpload is used if the client sends streams or datagrams
+	DirectionUpload Direction = 1 << iota
+	// DirectionDownload is used if the server sends streams or datagrams
+	DirectionDownload
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionUpload:
+		return "upload"
+	case DirectionDownload:
+		return "download"
+	case DirectionUpload | DirectionDownload:
+		return "bidirectional"
+	default:
+		return "none"
+	}
+}
+
+// TestDescription is sent by the client at the start of the connection.
+// Zero values are not encoded.
+type TestDescription struct {
+	Version uint64
+	// Duration of the test, the server closes the connection TestEndGracePeriod after it
+	Duration time.Duration
+	// Bitrate in bits per second, 0 means unlimited
+	Bitrate uint64
+	// Burst in bytes, 0 means default
+	Burst uint64
+	// DatagramSize is the size of the payload datagrams sent by the server, 0 means DefaultDatagramSize
+	DatagramSize uint64
+	// Direction of the data, the server closes the connection with a protocol error on data in other directions.
+	// 0 allows all directions.
+	Direction Direction
+	// Verify enables the pattern payload of streams and its verification at both ends
+	Verify bool
+	// UnknownParameters are the types of received parameters that are not supported, they are not encoded
+	UnknownParameters []ParameterType
+}
+
+// Append encodes the description including message type and length.
+func (d TestDescription) Append(b []byte) []byte {
+	payload := quicvarint.Append(nil, d.Version)
+	appendParameter := func(t ParameterType, value uint64) {
+		if value == 0 {
+			return
+		}
+		payload = quicvarint.Append(payload, uint64(t))
+		payload = quicvarint.Append(payload, uint64(quicvarint.Len(value)))
+		payload = quicvarint.Append(payload, value)
+	}
+	appendParameter(ParameterBitrate, d.Bitrate)
+	appendParameter(ParameterDuration, uint64(d.Duration.Milliseconds()))
+	appendParameter(ParameterBurst, d.Burst)
+	appendParameter(ParameterDatagramSize, d.DatagramSize)
+	appendParameter(ParameterDirection, uint64(d.Direction))
+	if d.Verify {
+		appendParameter(ParameterVerify, 1)
+	}
+	return appendControlMessage(b, MessageTypeTestDescription, payload)
+}
+
+// ParseTestDescription decodes the payload of a TestDescription.
+// The parameters of unsupported versions are not decoded.
+func ParseTestDescription(payload []byte) (TestDescription, error) {
+	r := bytes.NewReader(payload)
+	version, err := quicvarint.Read(r)
+	if err != nil {
+		return TestDescription{}, ErrInvalidControlMessage
+	}
+	d := TestDescription{Version: version}
+	if !SupportsControlProtocolVersion(version) {
+		return d, nil
+	}
+	for r.Len() > 0 {
+		t, err := quicvarint.Read(r)
+		if err != nil {
+			return TestDescription{}, ErrInvalidControlMessage
+		}
+		length, err := quicvarint.Read(r)
+		if err != nil || length > uint64(r.Len()) {
+			return TestDescription{}, ErrInvalidControlMessage
+		}
+		value := make([]byte, length)
+		_, _ = r.Read(value)
+		switch ParameterType(t) {
+		case ParameterBitrate:
+			d.Bitrate, err = parseVarintValue(value)
+		case ParameterDuration:
+			d.Duration, err = parseMillisecondsValue(value)
+		case ParameterBurst:
+			d.Burst, err = parseVarintValue(value)
+		case ParameterDatagramSize:
+			d.DatagramSize, err = parseVarintValue(value)
+		case ParameterDirection:
+			var direction uint64
+			direction, err = parseVarintValue(value)
+			d.Direction = Direction(direction)
+			if err == nil && d.Direction > DirectionUpload|DirectionDownload {
+				err = fmt.Errorf("invalid direction %d", direction)
+			}
+		case ParameterVerify:
+			var verify uint64
+			verify, err = parseVarintValue(value)
+			d.Verify = verify == 1
+			if err == nil && verify > 1 {
+				err = fmt.Errorf("invalid verify %d", verify)
+			}
+		default:
+			d.UnknownParameters = append(d.UnknownParameters, ParameterType(t))
+		}
+		if err != nil {
+			return TestDescription{}, fmt.Errorf("%w: parameter 0x%x: %w", ErrInvalidControlMessage, t, err)
+		}
+	}
+	return d, nil
+}
+
+// Validate returns the acknowledgement of the server for the description
+func (d TestDescription) Validate() TestAcknowledgement {
+	if !SupportsControlProtocolVersion(d.Version) {
+		return TestAcknowledgement{
+			Version:   SupportedControlProtocolVersions[0],
+			ErrorCode: ControlErrorUnsupportedVersion,
+			Reason:    fmt.Sprintf("unsupported version %d", d.Version),
+		}
+	}
+	for _, t := range d.UnknownParameters {
+		if t.Critical() {
+			return TestAcknowledgement{
+				Version:   d.Version,
+				ErrorCode: ControlErrorUnsupportedParameter,
+				Reason:    fmt.Sprintf("unsupported parameter 0x%x", uint64(t)),
+			}
+		}
+	}
+	return TestAcknowledgement{Version: d.Version}
+}
+
+func SupportsControlProtocolVersion(version uint64) bool {
+	for _, v := range SupportedControlProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+type ControlErrorCode uint64
+
+const (
+	ControlNoError ControlErrorCode = iota
+	ControlErrorUnsupportedVersion
+	ControlErrorUnsupportedParameter
+	ControlErrorInvalidMessage
+)
+
+// TestAcknowledgement is the response of the server to a TestDescription
+type TestAcknowledgement struct {
+	// Version of the description, or the highest version supported by the server if the version is not supported
+	Version   uint64
+	ErrorCode ControlErrorCode
+	Reason    string
+}
+
+// Append encodes the acknowledgement including message type and length.
+func (a TestAcknowledgement) Append(b []byte) []byte {
+	payload := quicvarint.Append(nil, a.Version)
+	payload = quicvarint.Append(payload, uint64(a.ErrorCode))
+	payload = append(payload, a.Reason...)
+	return appendControlMessage(b, MessageTypeTestAcknowledgement, payload)
+}
+
+// ParseTestAcknowledgement decodes the payload of a TestAcknowledgement.
+func ParseTestAcknowledgement(payload []byte) (TestAcknowledgement, error) {
+	r := bytes.NewReader(payload)
+	version, err := quicvarint.Read(r)
+	if err != nil {
+		return TestAcknowledgement{}, ErrInvalidControlMessage
+	}
+	errorCode, err := quicvarint.Read(r)
+	if err != nil {
+		return TestAcknowledgement{}, ErrInvalidControlMessage
+	}
+	return TestAcknowledgement{
+		Version:   version,
+		ErrorCode: ControlErrorCode(errorCode),
+		Reason:    string(payload[len(payload)-r.Len():]),
+	}, nil
+}
+
+// Err returns nil if the test was accepted
+func (a TestAcknowledgement) Err() error {
+	if a.ErrorCode == ControlNoError {
+		return nil
+	}
+	return &ControlError{ErrorCode: a.ErrorCode, Reason: a.Reason}
+}
+
+// ControlError is returned if the server rejected the test
+type ControlError struct {
+	ErrorCode ControlErrorCode
+	Reason    string
+}
+
+func (e *ControlError) Error() string {
+	return fmt.Sprintf("test rejected by the server (%d): %s", e.ErrorCode, e.Reason)
+}
+
+// ReadControlMessage reads the next message of the control stream and returns its type and payload.
+func ReadControlMessage(r io.Reader) (MessageType, []byte, error) {
+	reader := quicvarint.NewReader(r)
+	messageType, err := reader.ReadByte()
+	if err != nil {
+		return MessageTypeInvalid, nil, err
+	}
+	length, err := quicvarint.Read(reader)
+	if err != nil {
+		return MessageTypeInvalid, nil, err
+	}
+	if length > MaxControlMessageLength {
+		return MessageTypeInvalid, nil, ErrInvalidControlMessage
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return MessageTypeInvalid, nil, err
+	}
+	return MessageType(messageType), payload, nil
+}
+
+func appendControlMessage(b []byte, messageType MessageType, payload []byte) []byte {
+	b = append(b, byte(messageType))
+	b = quicvarint.Append(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+func parseVarintValue(value []byte) (uint64, error) {
+	r := bytes.NewReader(value)
+	v, err := quicvarint.Read(r)
+	if err != nil || r.Len() != 0 {
+		return 0, errors.New("expected varint")
+	}
+	return v, nil
+}
+
+func parseMillisecondsValue(value []byte) (time.Duration, error) {
+	ms, err := parseVarintValue(value)
+	return time.Duration(ms) * time.Millisecond, err
+}
@@ -0,0 +1,84 @@
+package perf
+
+import (
+	"bytes"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTestDescription(t *testing.T) {
+	description := TestDescription{
+		Version:      ControlProtocolVersion,
+		Duration:     10 * time.Second,
+		Bitrate:      50_000_000,
+		DatagramSize: 1000,
+		Direction:    DirectionUpload | DirectionDownload,
+	}
+	messageType, payload, err := ReadControlMessage(bytes.NewReader(description.Append(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, MessageTypeTestDescription, messageType)
+	parsed, err := ParseTestDescription(payload)
+	require.NoError(t, err)
+	assert.Equal(t, description, parsed)
+	assert.Equal(t, TestAcknowledgement{Version: ControlProtocolVersion}, parsed.Validate())
+}
+
+func TestTestDescriptionUnknownParameters(t *testing.T) {
+	payload := quicvarint.Append(nil, ControlProtocolVersion)
+	// optional parameter with a value that is not a varint
+	payload = append(payload, 0x40, 0x80, 3, 1, 2, 3)
+	parsed, err := ParseTestDescription(payload)
+	require.NoError(t, err)
+	assert.Equal(t, []ParameterType{0x80}, parsed.UnknownParameters)
+	assert.NoError(t, parsed.Validate().Err())
+
+	// critical parameter
+	payload = append(payload, 0x40, 0x81, 0)
+	parsed, err = ParseTestDescription(payload)
+	require.NoError(t, err)
+	ack := parsed.Validate()
+	assert.Equal(t, ControlErrorUnsupportedParameter, ack.ErrorCode)
+	assert.Error(t, ack.Err())
+}
+
+func TestTestDescriptionUnsupportedVersion(t *testing.T) {
+	payload := quicvarint.Append(nil, 1000)
+	// parameters of unknown versions are not parsed
+	payload = append(payload, 0xff)
+	parsed, err := ParseTestDescription(payload)
+	require.NoError(t, err)
+	ack := parsed.Validate()
+	assert.Equal(t, ControlErrorUnsupportedVersion, ack.ErrorCode)
+	assert.Equal(t, ControlProtocolVersion, ack.Version)
+}
+
+func TestTestDescriptionInvalid(t *testing.T) {
+	for _, payload := range [][]byte{
+		{},
+		// length exceeds the payload
+		{1, byte(ParameterBitrate), 2, 1},
+		// trailing bytes after the varint
+		{1, byte(ParameterBitrate), 2, 1, 1},
+		{1, byte(ParameterDirection), 1, 4},
+	} {
+		_, err := ParseTestDescription(payload)
+		assert.ErrorIs(t, err, ErrInvalidControlMessage, payload)
+	}
+}
+
+func TestTestAcknowledgement(t *testing.T) {
+	ack := TestAcknowledgement{
+		Version:   ControlProtocolVersion,
+		ErrorCode: ControlErrorUnsupportedParameter,
+		Reason:    "unsupported parameter 0x81",
+	}
+	messageType, payload, err := ReadControlMessage(bytes.NewReader(ack.Append(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, MessageTypeTestAcknowledgement, messageType)
+	parsed, err := ParseTestAcknowledgement(payload)
+	require.NoError(t, err)
+	assert.Equal(t, ack, parsed)
+}
@@ -0,0 +1,93 @@
+package perf
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/quic-go/quic-go"
+	"qperf-go/common"
+	"time"
+)
+
+// DefaultDatagramSize is the initial size of payload datagrams including the message type.
+// It is reduced if the connection does not allow datagrams of this size.
+const DefaultDatagramSize = 1200
+
+// DatagramRequestRetransmitInterval is the time after which a datagram request is sent again,
+// if no payload datagram has been received yet.
+const DatagramRequestRetransmitInterval = 100 * time.Millisecond
+
+// DatagramPayloadHeaderLength is the length of message type, sequence number and send timestamp.
+const DatagramPayloadHeaderLength = 1 + 8 + 8
+
+// DatagramRequestLength is the length of message type, bitrate and burst size.
+const DatagramRequestLength = 1 + 8 + 8
+
+var ErrDatagramTooShort = errors.New("datagram too short")
+
+// NewDatagramRequest returns a datagram that asks the server to send payload datagrams.
+// The bitrate is in bits per second, 0 means unlimited.
+// The burst is in bytes, 0 means default.
+func NewDatagramRequest(bitrate uint64, burst uint64) []byte {
+	buf := make([]byte, DatagramRequestLength)
+	buf[0] = byte(MessageTypeDatagramRequest)
+	binary.BigEndian.PutUint64(buf[1:9], bitrate)
+	binary.BigEndian.PutUint64(buf[9:17], burst)
+	return buf
+}
+
+// ParseDatagramRequest returns the bitrate and the burst size requested by a datagram request.
+func ParseDatagramRequest(buf []byte) (bitrate uint64, burst uint64, err error) {
+	if len(buf) < DatagramRequestLength {
+		return 0, 0, ErrDatagramTooShort
+	}
+	return binary.BigEndian.Uint64(buf[1:9]), binary.BigEndian.Uint64(buf[9:17]), nil
+}
+
+// PutDatagramPayloadHeader writes the header of a payload datagram.
+// The send time is encoded in nanoseconds since the unix epoch.
+func PutDatagramPayloadHeader(buf []byte, sequenceNumber uint64, sendTime time.Time) {
+	buf[0] = byte(MessageTypeDatagramPayload)
+	binary.BigEndian.PutUint64(buf[1:9], sequenceNumber)
+	binary.BigEndian.PutUint64(buf[9:17], uint64(sendTime.UnixNano()))
+}
+
+// ParseDatagramPayloadHeader returns the sequence number and send time of a payload datagram.
+func ParseDatagramPayloadHeader(buf []byte) (sequenceNumber uint64, sendTime time.Time, err error) {
+	if len(buf) < DatagramPayloadHeaderLength {
+		return 0, time.Time{}, ErrDatagramTooShort
+	}
+	sequenceNumber = binary.BigEndian.Uint64(buf[1:9])
+	sendTime = time.Unix(0, int64(binary.BigEndian.Uint64(buf[9:17])))
+	return sequenceNumber, sendTime, nil
+}
+
+// SendDatagrams sends payload datagrams until ctx is done.
+// Blocks while the send queue of the connection is full.
+// The size is reduced if the connection does not allow datagrams of this size.
+// If pacer is not nil, datagrams are sent at the rate of the token bucket.
+func SendDatagrams(ctx context.Context, conn quic.Connection, size int, pacer *common.TokenBucket) error {
+	buf := make([]byte, common.Max(size, DatagramPayloadHeaderLength))
+	var sequenceNumber uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		if pacer != nil {
+			pacer.Wait(len(buf))
+		}
+		PutDatagramPayloadHeader(buf, sequenceNumber, time.Now())
+		err := conn.SendDatagram(buf)
+		if err != nil {
+			var tooLargeErr *quic.DatagramTooLargeError
+			if errors.As(err, &tooLargeErr) && tooLargeErr.MaxDatagramPayloadSize >= DatagramPayloadHeaderLength {
+				buf = buf[:tooLargeErr.MaxDatagramPayloadSize]
+				continue
+			}
+			return err
+		}
+		sequenceNumber++
+	}
+}
@@ -1,10 +1,38 @@
 package perf
 
-import "github.com/quic-go/quic-go"
+import (
+	"errors"
+	"github.com/quic-go/quic-go"
+)
 
-// ALPN is from Section 2.1 in https://datatracker.ietf.org/doc/html/draft-banks-quic-performance-00
+// ALPN is from Section 2.1 in https://datatracker.ietf.org/doc/html/draft-banks-quic-performance-00.
+// Request streams start with the response length only, other perf implementations like secnetperf are compatible.
 const ALPN = "perf"
 
+// QperfALPN extends ALPN by the response delay, bitrate and burst in the request header,
+// the control stream, datagrams and results, see MessageType.
+const QperfALPN = "perf-qperf"
+
+// SupportsExtensions returns true if the ALPN allows the extensions of QperfALPN
+func SupportsExtensions(alpn string) bool {
+	return alpn == QperfALPN
+}
+
+var ErrExtensionNotSupported = errors.New("not supported with ALPN " + ALPN + ", requires " + QperfALPN)
+
+// ErrInvalidMessage is returned if the peer sent a message with an unknown MessageType or an unexpected message
+var ErrInvalidMessage = errors.New("invalid message")
+
+// IsProtocolError returns true if the error is caused by a malformed or unexpected message of the peer,
+// the connection is closed with errors.ProtocolErrorCode.
+func IsProtocolError(err error) bool {
+	return errors.Is(err, ErrInvalidMessage) ||
+		errors.Is(err, ErrDatagramTooShort) ||
+		errors.Is(err, ErrRequestHeaderTooShort) ||
+		errors.Is(err, ErrInvalidResults) ||
+		errors.Is(err, ErrInvalidControlMessage)
+}
+
 const DefaultServerPort = 18080
 
 const MaxResponseLength = ^uint64(0)
@@ -12,8 +40,21 @@ const MaxRequestLength = ^uint64(0)
 
 const DeadlineExceededStreamErrorCode quic.StreamErrorCode = 1
 
+// MessageType is the first byte of datagrams, unidirectional streams and control messages, only used with QperfALPN
 type MessageType uint8
 
 const (
 	MessageTypeInvalid MessageType = iota
+	// MessageTypeDatagramRequest asks the server to send payload datagrams until the connection is closed
+	MessageTypeDatagramRequest
+	// MessageTypeDatagramPayload carries data to measure datagram throughput, the content is ignored
+	MessageTypeDatagramPayload
+	// MessageTypeResultsRequest asks the server to send its Results
+	MessageTypeResultsRequest
+	// MessageTypeResults is followed by the Results of the server
+	MessageTypeResults
+	// MessageTypeTestDescription is sent by the client on the control stream, see TestDescription
+	MessageTypeTestDescription
+	// MessageTypeTestAcknowledgement is sent by the server on the control stream, see TestAcknowledgement
+	MessageTypeTestAcknowledgement
 )
@@ -0,0 +1,148 @@
+package perf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+)
+
+// Payload generates the content of request and response streams after the request header.
+// The payload is not sent with verification, see NewPatternReader.
+type Payload interface {
+	// NewReader returns an infinite reader for the payload of a stream
+	NewReader() io.Reader
+	String() string
+}
+
+// minRepeatingLength is the minimum length of the data copied by repeating readers at once
+const minRepeatingLength = 4096
+
+// ZeroPayload sends zero bytes
+type ZeroPayload struct{}
+
+func (ZeroPayload) NewReader() io.Reader {
+	return zeroReader{}
+}
+
+func (ZeroPayload) String() string {
+	return "zeros"
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// PatternPayload repeats the pattern
+type PatternPayload []byte
+
+func (p PatternPayload) NewReader() io.Reader {
+	return newRepeatingReader(p)
+}
+
+func (p PatternPayload) String() string {
+	return "pattern:0x" + hex.EncodeToString(p)
+}
+
+// RandomPayload sends incompressible pseudo-random bytes, seeded randomly for every stream
+type RandomPayload struct{}
+
+func (RandomPayload) NewReader() io.Reader {
+	var seed [32]byte
+	for i := 0; i < len(seed); i += 8 {
+		binary.LittleEndian.PutUint64(seed[i:], rand.Uint64())
+	}
+	return rand.NewChaCha8(seed)
+}
+
+func (RandomPayload) String() string {
+	return "random"
+}
+
+// FilePayload repeats the content of a file, which is loaded into memory by LoadFilePayload
+type FilePayload struct {
+	Path string
+	data []byte
+}
+
+// LoadFilePayload reads the file at path
+func LoadFilePayload(path string) (FilePayload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FilePayload{}, err
+	}
+	if len(data) == 0 {
+		return FilePayload{}, fmt.Errorf("%s is empty", path)
+	}
+	return FilePayload{Path: path, data: data}, nil
+}
+
+func (p FilePayload) NewReader() io.Reader {
+	return newRepeatingReader(p.data)
+}
+
+func (p FilePayload) String() string {
+	return "file:" + p.Path
+}
+
+type repeatingReader struct {
+	data   []byte
+	offset int
+}
+
+func newRepeatingReader(pattern []byte) *repeatingReader {
+	// repeat short patterns to avoid copying only a few bytes at once
+	count := (minRepeatingLength + len(pattern) - 1) / len(pattern)
+	return &repeatingReader{data: bytes.Repeat(pattern, count)}
+}
+
+func (r *repeatingReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.data[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.data)
+	}
+	return n, nil
+}
+
+// ParsePayload supports the following formats:
+// zeros; random for pseudo-random bytes;
+// pattern:<text> or pattern:0x<hex> to repeat the pattern; file:<path> to repeat the content of the file.
+func ParsePayload(s string) (Payload, error) {
+	kind, value, _ := strings.Cut(s, ":")
+	switch kind {
+	case "zeros":
+		return ZeroPayload{}, nil
+	case "random":
+		return RandomPayload{}, nil
+	case "pattern":
+		pattern := []byte(value)
+		if hexPattern, ok := strings.CutPrefix(value, "0x"); ok {
+			var err error
+			pattern, err = hex.DecodeString(hexPattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex pattern: %w", err)
+			}
+		}
+		if len(pattern) == 0 {
+			return nil, errors.New("empty pattern")
+		}
+		return PatternPayload(pattern), nil
+	case "file":
+		if value == "" {
+			return nil, errors.New("missing file path")
+		}
+		return LoadFilePayload(value)
+	default:
+		return nil, fmt.Errorf("unknown payload %s", s)
+	}
+}
@@ -0,0 +1,67 @@
+package perf
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readPayload(t *testing.T, payload Payload, n int) []byte {
+	buf := make([]byte, n)
+	// read in odd chunks to cover partial copies of repeating readers
+	reader := payload.NewReader()
+	for i := 0; i < n; i += 1000 {
+		_, err := io.ReadFull(reader, buf[i:min(i+1000, n)])
+		require.NoError(t, err)
+	}
+	return buf
+}
+
+func TestParsePayload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+
+	for _, test := range []struct {
+		s        string
+		expected []byte
+	}{
+		{"zeros", make([]byte, 30)},
+		{"pattern:abc", bytes.Repeat([]byte("abc"), 10)},
+		{"pattern:0xff00", bytes.Repeat([]byte{0xff, 0}, 15)},
+		{"file:" + path, bytes.Repeat([]byte("0123456789"), 3)},
+	} {
+		payload, err := ParsePayload(test.s)
+		require.NoError(t, err, test.s)
+		assert.Equal(t, test.expected, readPayload(t, payload, len(test.expected)), test.s)
+		assert.Equal(t, bytes.Repeat(test.expected, 500)[:12345], readPayload(t, payload, 12345), test.s)
+	}
+
+	payload, err := ParsePayload("pattern:0xff00")
+	require.NoError(t, err)
+	assert.Equal(t, "pattern:0xff00", payload.String())
+
+	for _, s := range []string{"", "ones", "pattern:", "pattern:0xf", "file:", "file:" + filepath.Join(t.TempDir(), "missing")} {
+		_, err := ParsePayload(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRandomPayload(t *testing.T) {
+	payload, err := ParsePayload("random")
+	require.NoError(t, err)
+	a := readPayload(t, payload, 4096)
+	b := readPayload(t, payload, 4096)
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, make([]byte, 4096), a)
+}
+
+func TestZeroPayloadClearsBuffer(t *testing.T) {
+	buf := []byte{1, 2, 3}
+	_, err := ZeroPayload{}.NewReader().Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0}, buf)
+}
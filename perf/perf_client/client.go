@@ -3,8 +3,11 @@ package perf_client
 import (
 	"context"
 	errors2 "errors"
+	"fmt"
 	"github.com/quic-go/quic-go"
+	"io"
 	"net"
+	"qperf-go/common"
 	"qperf-go/errors"
 	"qperf-go/perf"
 	"sync"
@@ -18,10 +21,22 @@ type Client interface {
 	Close() error
 	ReceivedBytes() uint64
 	SentBytes() uint64
+	// RequestResults asks the server for its view on the connection.
+	// Must not be called concurrently.
+	RequestResults(ctx context.Context) (perf.Results, error)
+	// RequestDatagrams asks the server to send datagrams until the connection is closed
+	RequestDatagrams() error
+	// SendDatagrams sends datagrams to the server until the connection is closed
+	SendDatagrams()
+	QuicConn() quic.Connection
+	// HandshakeComplete is closed when the handshake completed, see quic.EarlyConnection
+	HandshakeComplete() <-chan struct{}
 }
 
 type client struct {
 	conn                    quic.Connection
+	transport               *quic.Transport
+	handshakeComplete       <-chan struct{}
 	config                  *Config
 	closeOnce               sync.Once
 	ctx                     context.Context
@@ -29,6 +44,10 @@ type client struct {
 	receivedBytes           atomic.Uint64
 	sentBytes               atomic.Uint64
 	datagramReceiveLoopDone chan struct{}
+	// closed when the first payload datagram is received
+	firstDatagramReceived chan struct{}
+	// results from the server, buffered to not block the stream handler
+	results chan perf.Results
 }
 
 func (c *client) Context() context.Context {
@@ -36,34 +55,63 @@ func (c *client) Context() context.Context {
 }
 
 func DialAddr(remoteAddr string, conf *Config, early bool) (Client, error) {
+	conf = conf.Populate()
 	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
 	if err != nil {
 		return nil, err
 	}
-	t := quic.Transport{
-		Conn:               udpConn,
+	var packetConn net.PacketConn = udpConn
+	if conf.Emulation != nil {
+		packetConn = common.NewEmulatedConn(udpConn, conf.Emulation)
+	}
+	t := &quic.Transport{
+		Conn:               packetConn,
 		ConnectionIDLength: 4,
 	}
 	c := &client{
-		config:                  conf.Populate(),
+		config:                  conf,
+		transport:               t,
 		datagramReceiveLoopDone: make(chan struct{}),
+		firstDatagramReceived:   make(chan struct{}),
+		results:                 make(chan perf.Results, 1),
 	}
 	c.ctx, c.cancelCtx = context.WithCancelCause(context.Background())
 
 	addr, err := net.ResolveUDPAddr("udp", remoteAddr)
 	if err != nil {
+		c.closeTransport()
 		return nil, err
 	}
 
 	if early {
-		c.conn, err = t.DialEarly(c.ctx, addr, c.config.TlsConfig, c.config.QuicConfig)
+		var earlyConn quic.EarlyConnection
+		earlyConn, err = t.DialEarly(c.ctx, addr, c.config.TlsConfig, c.config.QuicConfig)
+		if err == nil {
+			c.conn = earlyConn
+			c.handshakeComplete = earlyConn.HandshakeComplete()
+		}
 	} else {
 		c.conn, err = t.Dial(c.ctx, addr, c.config.TlsConfig, c.config.QuicConfig)
+		// Dial returns after the handshake completed
+		handshakeComplete := make(chan struct{})
+		close(handshakeComplete)
+		c.handshakeComplete = handshakeComplete
 	}
 	if err != nil {
+		c.closeTransport()
 		return nil, err
 	}
 
+	if perf.SupportsExtensions(c.alpn()) {
+		err = c.openControlStream()
+		if err != nil {
+			// run has not started the datagram receive loop, which close waits for
+			close(c.datagramReceiveLoopDone)
+			c.close(err)
+			return nil, err
+		}
+	}
+
 	go func() {
 		err := c.run()
 		if err != nil {
@@ -74,42 +122,119 @@ func DialAddr(remoteAddr string, conf *Config, early bool) (Client, error) {
 	return c, nil
 }
 
-func (c *client) run() error {
+// openControlStream sends the test description, it must be the first opened stream.
+// The connection is closed with a perf.ControlError if the server rejects the test.
+func (c *client) openControlStream() error {
+	stream, err := c.conn.OpenStream()
+	if err != nil {
+		return err
+	}
+	if stream.StreamID() != perf.ControlStreamID {
+		return fmt.Errorf("control stream is not the first stream, stream ID %d", stream.StreamID())
+	}
+	description := *c.config.TestDescription
+	description.Version = perf.ControlProtocolVersion
+	description.Bitrate = c.config.Bitrate
+	description.Burst = c.config.Burst
+	description.DatagramSize = c.config.DatagramSize
+	description.Verify = c.config.Verify
+	_, err = stream.Write(description.Append(nil))
+	if err != nil {
+		return err
+	}
+	err = stream.Close()
+	if err != nil {
+		return err
+	}
 	go func() {
-		err := c.runStreamAcceptLoop()
+		err := c.receiveTestAcknowledgement(stream)
 		if err != nil {
 			c.close(err)
 		}
 	}()
+	return nil
+}
+
+func (c *client) receiveTestAcknowledgement(stream quic.ReceiveStream) error {
+	messageType, payload, err := perf.ReadControlMessage(stream)
+	if err != nil {
+		return err
+	}
+	if messageType != perf.MessageTypeTestAcknowledgement {
+		return perf.ErrInvalidControlMessage
+	}
+	ack, err := perf.ParseTestAcknowledgement(payload)
+	if err != nil {
+		return err
+	}
+	return ack.Err()
+}
+
+func (c *client) run() error {
 	go func() {
-		err := c.runDatagramReceiveLoop()
+		err := c.runStreamAcceptLoop()
 		if err != nil {
 			c.close(err)
 		}
 	}()
+	if c.config.QuicConfig != nil && c.config.QuicConfig.EnableDatagrams {
+		go func() {
+			err := c.runDatagramReceiveLoop()
+			if err != nil {
+				c.close(err)
+			}
+		}()
+	} else {
+		close(c.datagramReceiveLoopDone)
+	}
 	<-c.ctx.Done()
 	return nil
 }
 
-func (c *client) acceptResponseReceiveStream() (ResponseReceiveStream, error) {
-	_, err := c.conn.AcceptUniStream(context.Background())
-	if err != nil {
-		return nil, err
+func (c *client) runStreamAcceptLoop() error {
+	for {
+		stream, err := c.conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := c.handleUniStream(stream)
+			if err != nil {
+				c.close(err)
+			}
+		}()
 	}
-	panic("implement me")
 }
 
-func (c *client) runStreamAcceptLoop() error {
-	for {
-		_, err := c.acceptResponseReceiveStream()
+func (c *client) handleUniStream(stream quic.ReceiveStream) error {
+	buf, err := io.ReadAll(io.LimitReader(stream, perf.MaxResultsLength))
+	if err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		return fmt.Errorf("%w: empty stream", perf.ErrInvalidMessage)
+	}
+	switch perf.MessageType(buf[0]) {
+	case perf.MessageTypeResults:
+		results, err := perf.ParseResults(buf)
 		if err != nil {
 			return err
 		}
+		select {
+		case c.results <- results:
+		default:
+			return fmt.Errorf("%w: unexpected results", perf.ErrInvalidMessage)
+		}
 		return nil
+	default:
+		return fmt.Errorf("%w: unexpected stream type %d", perf.ErrInvalidMessage, buf[0])
 	}
 }
 
 func (c *client) Request(requestLength uint64, responseLength uint64, responseDelay time.Duration) (RequestSendStream, ResponseReceiveStream, error) {
+	if (responseDelay != 0 || c.config.Verify) && !perf.SupportsExtensions(c.alpn()) {
+		return nil, nil, perf.ErrExtensionNotSupported
+	}
 	stream, err := c.conn.OpenStream()
 	if err != nil {
 		return nil, nil, err
@@ -125,16 +250,25 @@ func (c *client) Request(requestLength uint64, responseLength uint64, responseDe
 // nil to close without error
 func (c *client) close(err error) {
 	c.closeOnce.Do(func() {
-		if err != nil {
+		if perf.IsProtocolError(err) {
+			_ = c.conn.CloseWithError(errors.ProtocolErrorCode, err.Error())
+		} else if err != nil {
 			_ = c.conn.CloseWithError(errors.InternalErrorCode, "internal error")
 		} else {
 			err = c.conn.CloseWithError(errors.NoError, "no error")
 		}
 		<-c.datagramReceiveLoopDone
+		c.closeTransport()
 		c.cancelCtx(err)
 	})
 }
 
+// closeTransport closes the UDP socket, which is not closed by the transport itself
+func (c *client) closeTransport() {
+	_ = c.transport.Close()
+	_ = c.transport.Conn.Close()
+}
+
 func (c *client) Close() error {
 	c.close(nil)
 	cause := context.Cause(c.ctx)
@@ -144,6 +278,14 @@ func (c *client) Close() error {
 	return nil
 }
 
+func (c *client) QuicConn() quic.Connection {
+	return c.conn
+}
+
+func (c *client) HandshakeComplete() <-chan struct{} {
+	return c.handshakeComplete
+}
+
 func (c *client) ReceivedBytes() uint64 {
 	return c.receivedBytes.Load()
 }
@@ -159,10 +301,113 @@ func (c *client) runDatagramReceiveLoop() error {
 		if err != nil {
 			return err
 		}
+		if len(buf) == 0 {
+			return fmt.Errorf("%w: empty datagram", perf.ErrInvalidMessage)
+		}
 		messageType := perf.MessageType(buf[0])
 		switch messageType {
+		case perf.MessageTypeDatagramPayload:
+			receiveTime := time.Now()
+			sequenceNumber, sendTime, err := perf.ParseDatagramPayloadHeader(buf)
+			if err != nil {
+				return err
+			}
+			if c.config.OnDatagramReceive != nil {
+				c.config.OnDatagramReceive(sequenceNumber, sendTime, receiveTime)
+			}
+			select {
+			case <-c.firstDatagramReceived:
+			default:
+				close(c.firstDatagramReceived)
+			}
 		default:
-			panic("unexpected message type")
+			return fmt.Errorf("%w: unexpected datagram type %d", perf.ErrInvalidMessage, messageType)
+		}
+	}
+}
+
+func (c *client) reportVerification(result perf.VerificationResult) {
+	if c.config.OnVerification != nil {
+		c.config.OnVerification(result)
+	}
+}
+
+// alpn returns the negotiated ALPN, or the offered one if the handshake is not complete yet
+func (c *client) alpn() string {
+	if alpn := c.conn.ConnectionState().TLS.NegotiatedProtocol; alpn != "" {
+		return alpn
+	}
+	return c.config.TlsConfig.NextProtos[0]
+}
+
+func (c *client) RequestDatagrams() error {
+	if !perf.SupportsExtensions(c.alpn()) {
+		return perf.ErrExtensionNotSupported
+	}
+	request := perf.NewDatagramRequest(c.config.Bitrate, c.config.Burst)
+	err := c.conn.SendDatagram(request)
+	if err != nil {
+		return err
+	}
+	// datagrams might be lost, repeat request until the first response arrives
+	go func() {
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-c.firstDatagramReceived:
+				return
+			case <-time.After(perf.DatagramRequestRetransmitInterval):
+				err := c.conn.SendDatagram(request)
+				if err != nil {
+					c.close(err)
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *client) SendDatagrams() {
+	go func() {
+		if !perf.SupportsExtensions(c.alpn()) {
+			c.close(perf.ErrExtensionNotSupported)
+			return
+		}
+		var pacer *common.TokenBucket
+		if c.config.Bitrate != 0 {
+			pacer = common.NewTokenBucket(c.config.Bitrate, c.config.Burst)
+		}
+		err := perf.SendDatagrams(c.ctx, c.conn, int(c.config.DatagramSize), pacer)
+		if err != nil {
+			c.close(err)
 		}
+	}()
+}
+
+func (c *client) RequestResults(ctx context.Context) (perf.Results, error) {
+	if !perf.SupportsExtensions(c.alpn()) {
+		return perf.Results{}, perf.ErrExtensionNotSupported
+	}
+	stream, err := c.conn.OpenUniStream()
+	if err != nil {
+		return perf.Results{}, err
+	}
+	_, err = stream.Write([]byte{byte(perf.MessageTypeResultsRequest)})
+	if err != nil {
+		return perf.Results{}, err
+	}
+	err = stream.Close()
+	if err != nil {
+		return perf.Results{}, err
+	}
+	select {
+	case results := <-c.results:
+		return results, nil
+	case <-ctx.Done():
+		return perf.Results{}, ctx.Err()
+	case <-c.ctx.Done():
+		return perf.Results{}, context.Cause(c.ctx)
 	}
 }
@@ -4,8 +4,10 @@ import (
 	"crypto/tls"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
+	"qperf-go/common"
 	"qperf-go/common/qlog"
 	"qperf-go/perf"
+	"time"
 )
 
 type Config struct {
@@ -13,7 +15,30 @@ type Config struct {
 	QuicConfig      *quic.Config
 	OnStreamSend    func(id quic.StreamID, count logging.ByteCount)
 	OnStreamReceive func(id quic.StreamID, count logging.ByteCount)
-	Qlog            qlog.Writer
+	// OnDatagramReceive is called for every received payload datagram
+	OnDatagramReceive func(sequenceNumber uint64, sendTime time.Time, receiveTime time.Time)
+	Qlog              qlog.Writer
+	// Bitrate limits every request stream and the datagram flow in both directions, in bits per second.
+	// 0 means unlimited.
+	Bitrate uint64
+	// Burst is the burst size of the pacer in bytes.
+	// 0 means default.
+	Burst uint64
+	// Emulation impairs the packets of the connection, nil if disabled
+	Emulation *common.EmulationConfig
+	// DatagramSize is the size of payload datagrams in both directions.
+	// 0 means perf.DefaultDatagramSize.
+	DatagramSize uint64
+	// TestDescription is sent on the control stream with perf.QperfALPN,
+	// bitrate, burst, datagram size and verification are taken from the config.
+	TestDescription *perf.TestDescription
+	// Verify sends and expects the pattern payload of perf.NewPatternReader on all streams, only with perf.QperfALPN
+	Verify bool
+	// OnVerification is called for every received stream with Verify,
+	// at the first mismatch or when the stream is closed
+	OnVerification func(result perf.VerificationResult)
+	// Payload of request streams, defaults to perf.ZeroPayload
+	Payload perf.Payload
 }
 
 func (c *Config) Populate() *Config {
@@ -24,7 +49,16 @@ func (c *Config) Populate() *Config {
 		c.TlsConfig = &tls.Config{}
 	}
 	if c.TlsConfig.NextProtos == nil {
-		c.TlsConfig.NextProtos = []string{perf.ALPN}
+		c.TlsConfig.NextProtos = []string{perf.QperfALPN}
+	}
+	if c.DatagramSize == 0 {
+		c.DatagramSize = perf.DefaultDatagramSize
+	}
+	if c.TestDescription == nil {
+		c.TestDescription = &perf.TestDescription{}
+	}
+	if c.Payload == nil {
+		c.Payload = perf.ZeroPayload{}
 	}
 	return c
 }
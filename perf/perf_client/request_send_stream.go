@@ -1,8 +1,8 @@
 package perf_client
 
 import (
+	"bytes"
 	"context"
-	"encoding/binary"
 	"github.com/quic-go/quic-go"
 	"io"
 	"qperf-go/common"
@@ -55,14 +55,27 @@ func newRequestSendStream(quicStream quic.SendStream, requestLength uint64, resp
 
 func (s *requestSendStream) run() error {
 	var buf [65536]byte
-	binary.LittleEndian.PutUint64(buf[:], s.responseLength)
-	binary.LittleEndian.PutUint32(buf[8:], uint32(s.responseDelay.Milliseconds()))
+	alpn := s.client.alpn()
+	header := perf.RequestHeader{
+		ResponseLength:  s.responseLength,
+		ResponseDelay:   s.responseDelay,
+		ResponseBitrate: s.client.config.Bitrate,
+		ResponseBurst:   uint32(s.client.config.Burst),
+	}.Append(nil, alpn)
 	sendStream := io.MultiWriter(s.quicStream, utils.FuncToWriter(func(p []byte) (n int, err error) {
 		s.sentBytes.Add(uint64(len(p)))
 		s.client.sentBytes.Add(uint64(len(p)))
 		return len(p), err
 	}))
-	_, err := io.CopyBuffer(sendStream, common.LimitReader(utils.InfiniteReader{}, common.Max(s.requestLength, 12)), buf[:])
+	payload := s.client.config.Payload.NewReader()
+	if s.client.config.Verify {
+		payload = perf.NewPatternReader(s.quicStream.StreamID(), false)
+	}
+	reader := io.MultiReader(bytes.NewReader(header), payload)
+	if s.client.config.Bitrate != 0 {
+		reader = common.NewPacedReader(reader, common.NewTokenBucket(s.client.config.Bitrate, s.client.config.Burst))
+	}
+	_, err := io.CopyBuffer(sendStream, common.LimitReader(reader, common.Max(s.requestLength, uint64(len(header)))), buf[:])
 	if err != nil {
 		return err
 	}
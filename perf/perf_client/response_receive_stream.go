@@ -10,6 +10,7 @@ import (
 )
 
 type ResponseReceiveStream interface {
+	StreamID() quic.StreamID
 	ReceivedBytes() uint64
 	Context() context.Context
 	Cancel()
@@ -36,6 +37,8 @@ func newResponseReceiveStream(quicStream quic.ReceiveStream, client *client, exp
 	go func() {
 		err := s.run()
 		if err != nil {
+			// also done if the stream is canceled by Cancel or reset by the server
+			s.cancelCtx()
 			switch err := err.(type) {
 			case *quic.StreamError:
 				switch err.ErrorCode {
@@ -57,11 +60,26 @@ func (s *responseReceiveStream) ReceivedBytes() uint64 {
 
 func (s *responseReceiveStream) run() error {
 	var buf [65536]byte
+	var verifier *perf.PatternVerifier
+	if s.client.config.Verify {
+		verifier = perf.NewPatternVerifier(s.quicStream.StreamID(), true, 0)
+	}
+	reported := false
 	_, err := io.CopyBuffer(utils.FuncToWriter(func(p []byte) (n int, err error) {
 		s.receivedBytes.Add(uint64(len(p)))
 		s.client.receivedBytes.Add(uint64(len(p)))
+		if verifier != nil && !reported {
+			_, _ = verifier.Write(p)
+			if verifier.Failed() {
+				reported = true
+				s.client.reportVerification(verifier.Result(false))
+			}
+		}
 		return len(p), nil
 	}), s.quicStream, buf[:])
+	if verifier != nil && !reported {
+		s.client.reportVerification(verifier.Result(err == nil))
+	}
 	if err != nil {
 		return err
 	}
@@ -84,3 +102,7 @@ func (s *responseReceiveStream) Cancel() {
 func (s *responseReceiveStream) Success() bool {
 	return s.success
 }
+
+func (s *responseReceiveStream) StreamID() quic.StreamID {
+	return s.quicStream.StreamID()
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/quic-go/quic-go"
 	"qperf-go/common/qlog"
 	"qperf-go/perf"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,15 @@ type Config struct {
 	QuicConfig *quic.Config
 	QlogLabel  string
 	Qlog       qlog.Writer
+	// OnDatagramReceive is called for every received payload datagram
+	OnDatagramReceive func(conn Connection, sequenceNumber uint64, sendTime time.Time, receiveTime time.Time)
+	// OnTestDescription is called when the server accepted the test description of the client, only with perf.QperfALPN
+	OnTestDescription func(conn Connection, description perf.TestDescription)
+	// OnVerification is called for every received request stream if the client enabled verification,
+	// at the first mismatch or when the stream is closed
+	OnVerification func(conn Connection, result perf.VerificationResult)
+	// Payload of response streams, defaults to perf.ZeroPayload
+	Payload perf.Payload
 }
 
 func (c *Config) Populate() *Config {
@@ -22,12 +32,15 @@ func (c *Config) Populate() *Config {
 		c.TlsConfig = &tls.Config{}
 	}
 	if c.TlsConfig.NextProtos == nil {
-		c.TlsConfig.NextProtos = []string{perf.ALPN}
+		c.TlsConfig.NextProtos = []string{perf.QperfALPN, perf.ALPN}
 	}
 	if c.QuicConfig == nil {
 		c.QuicConfig = &quic.Config{}
 		c.QuicConfig.Allow0RTT = true
 		c.QuicConfig.EnableDatagrams = true
 	}
+	if c.Payload == nil {
+		c.Payload = perf.ZeroPayload{}
+	}
 	return c
 }
@@ -2,9 +2,14 @@ package perf_server
 
 import (
 	"context"
+	"fmt"
 	"github.com/quic-go/quic-go"
+	"io"
+	"qperf-go/common"
 	"qperf-go/errors"
+	"qperf-go/perf"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,11 +19,17 @@ type Connection interface {
 	// Close connection without error
 	Close()
 	QuicConn() quic.Connection
+	// ReceivedBytes returns the number of received stream bytes, excluding request headers
+	ReceivedBytes() uint64
+	// SentBytes returns the number of sent stream bytes
+	SentBytes() uint64
 }
 
 type connection struct {
 	quicConnection quic.Connection
-	closeOnce      sync.Once
+	// negotiated ALPN, decides about the request header format and the extensions
+	alpn      string
+	closeOnce sync.Once
 	// only set within closeOnce
 	err   error
 	mutex sync.Mutex
@@ -27,15 +38,38 @@ type connection struct {
 	// only access while holding mutex
 	responseSendStreams map[quic.StreamID]ResponseSendStream
 	config              *Config
+	datagramSendOnce    sync.Once
+	receivedBytes       atomic.Uint64
+	sentBytes           atomic.Uint64
+	// only payload datagrams
+	receivedDatagramBytes atomic.Uint64
+	receivedDatagrams     atomic.Uint64
+	// verification of the request streams
+	verifiedStreams atomic.Uint64
+	failedStreams   atomic.Uint64
+	verifiedBytes   atomic.Uint64
+	startTime       time.Time
+	// closed when the control stream is handled, or perf.ControlStreamTimeout after the connection was accepted
+	testDescriptionDone chan struct{}
+	testDescriptionOnce sync.Once
+	// only access after testDescriptionDone is closed, the zero value if no test description was accepted
+	testDescription perf.TestDescription
 }
 
 func NewConnection(quicConnection quic.EarlyConnection, config *Config) Connection {
 	c := &connection{
 		quicConnection:        quicConnection,
+		alpn:                  quicConnection.ConnectionState().TLS.NegotiatedProtocol,
 		requestReceiveStreams: map[quic.StreamID]RequestReceiveStream{},
 		responseSendStreams:   map[quic.StreamID]ResponseSendStream{},
 		config:                config,
+		startTime:             time.Now(),
+		testDescriptionDone:   make(chan struct{}),
 	}
+	// clients without control stream are served with the defaults
+	time.AfterFunc(perf.ControlStreamTimeout, func() {
+		c.setTestDescription(perf.TestDescription{})
+	})
 	go func() {
 		err := c.run()
 		if err != nil {
@@ -67,7 +101,7 @@ func (c *connection) handleRequestReceiveStream(reqStream RequestReceiveStream,
 				c.mutex.Unlock()
 				return
 			}
-			_, err := c.newResponseSendStream(quicStream, reqStream.ResponseLength(), reqStream.ResponseDelay())
+			_, err := c.newResponseSendStream(quicStream, reqStream.ResponseLength(), reqStream.ResponseDelay(), reqStream.ResponseBitrate(), reqStream.ResponseBurst())
 			if err != nil {
 				c.close(err)
 			}
@@ -76,8 +110,8 @@ func (c *connection) handleRequestReceiveStream(reqStream RequestReceiveStream,
 	return nil
 }
 
-func (c *connection) newResponseSendStream(stream quic.Stream, length uint64, delay time.Duration) (ResponseSendStream, error) {
-	respStream := newResponseSendStream(stream, length, delay, c)
+func (c *connection) newResponseSendStream(stream quic.Stream, length uint64, delay time.Duration, bitrate uint64, burst uint64) (ResponseSendStream, error) {
+	respStream := newResponseSendStream(stream, length, delay, bitrate, burst, c)
 	c.mutex.Lock()
 	c.responseSendStreams[respStream.StreamID()] = respStream
 	c.mutex.Unlock()
@@ -94,11 +128,36 @@ func (c *connection) newResponseSendStream(stream quic.Stream, length uint64, de
 }
 
 func (c *connection) run() error {
+	if perf.SupportsExtensions(c.alpn) {
+		go func() {
+			err := c.runUniStreamAcceptLoop()
+			if err != nil {
+				c.close(err)
+			}
+		}()
+	}
+	if c.config.QuicConfig.EnableDatagrams && perf.SupportsExtensions(c.alpn) {
+		go func() {
+			err := c.runDatagramReceiveLoop()
+			if err != nil {
+				c.close(err)
+			}
+		}()
+	}
 	for {
 		stream, err := c.quicConnection.AcceptStream(c.Context())
 		if err != nil {
 			return err
 		}
+		if perf.SupportsExtensions(c.alpn) && stream.StreamID() == perf.ControlStreamID {
+			go func() {
+				err := c.handleControlStream(stream)
+				if err != nil {
+					c.close(err)
+				}
+			}()
+			continue
+		}
 		_, err = c.newRequestReceiveStream(stream)
 		if err != nil {
 			return err
@@ -106,9 +165,244 @@ func (c *connection) run() error {
 	}
 }
 
+func (c *connection) runDatagramReceiveLoop() error {
+	for {
+		buf, err := c.quicConnection.ReceiveDatagram(c.Context())
+		if err != nil {
+			return err
+		}
+		if len(buf) == 0 {
+			return fmt.Errorf("%w: empty datagram", perf.ErrInvalidMessage)
+		}
+		messageType := perf.MessageType(buf[0])
+		switch messageType {
+		case perf.MessageTypeDatagramRequest:
+			bitrate, burst, err := perf.ParseDatagramRequest(buf)
+			if err != nil {
+				return err
+			}
+			// requests are repeated by the client until the first datagram arrives
+			c.datagramSendOnce.Do(func() {
+				var pacer *common.TokenBucket
+				if bitrate != 0 {
+					pacer = common.NewTokenBucket(bitrate, burst)
+				}
+				go func() {
+					// the size is part of the test description, which might arrive after the request
+					err := c.allows(perf.DirectionDownload)
+					if err != nil {
+						c.close(err)
+						return
+					}
+					description, ok := c.awaitTestDescription()
+					if !ok {
+						return
+					}
+					size := description.DatagramSize
+					if size == 0 {
+						size = perf.DefaultDatagramSize
+					}
+					err = perf.SendDatagrams(c.Context(), c.quicConnection, int(size), pacer)
+					if err != nil {
+						c.close(err)
+					}
+				}()
+			})
+		case perf.MessageTypeDatagramPayload:
+			receiveTime := time.Now()
+			sequenceNumber, sendTime, err := perf.ParseDatagramPayloadHeader(buf)
+			if err != nil {
+				return err
+			}
+			err = c.allows(perf.DirectionUpload)
+			if err != nil {
+				return err
+			}
+			c.receivedDatagramBytes.Add(uint64(len(buf)))
+			c.receivedDatagrams.Add(1)
+			if c.config.OnDatagramReceive != nil {
+				c.config.OnDatagramReceive(c, sequenceNumber, sendTime, receiveTime)
+			}
+		default:
+			return fmt.Errorf("%w: unexpected datagram type %d", perf.ErrInvalidMessage, messageType)
+		}
+	}
+}
+
+// handleControlStream acknowledges the test description of the client.
+// Rejected tests are closed by the client.
+func (c *connection) handleControlStream(stream quic.Stream) error {
+	// the defaults are used if the control stream fails
+	defer c.setTestDescription(perf.TestDescription{})
+	messageType, payload, err := perf.ReadControlMessage(stream)
+	if err != nil {
+		return err
+	}
+	var description perf.TestDescription
+	var ack perf.TestAcknowledgement
+	if messageType != perf.MessageTypeTestDescription {
+		ack = perf.TestAcknowledgement{
+			Version:   perf.SupportedControlProtocolVersions[0],
+			ErrorCode: perf.ControlErrorInvalidMessage,
+			Reason:    "expected test description",
+		}
+	} else if description, err = perf.ParseTestDescription(payload); err != nil {
+		ack = perf.TestAcknowledgement{
+			Version:   perf.SupportedControlProtocolVersions[0],
+			ErrorCode: perf.ControlErrorInvalidMessage,
+			Reason:    err.Error(),
+		}
+	} else {
+		ack = description.Validate()
+	}
+	_, err = stream.Write(ack.Append(nil))
+	if err != nil {
+		return err
+	}
+	err = stream.Close()
+	if err != nil {
+		return err
+	}
+	if ack.ErrorCode != perf.ControlNoError {
+		return nil
+	}
+	if !c.setTestDescription(description) {
+		return nil
+	}
+	if description.Duration != 0 {
+		go c.closeAfter(description.Duration + perf.TestEndGracePeriod)
+	}
+	if c.config.OnTestDescription != nil {
+		c.config.OnTestDescription(c, description)
+	}
+	return nil
+}
+
+// closeAfter ends the test after its duration, unless the client closed the connection before
+func (c *connection) closeAfter(duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		c.close(nil)
+	case <-c.Context().Done():
+	}
+}
+
+// setTestDescription returns false if the test description was already set, e.g. after perf.ControlStreamTimeout
+func (c *connection) setTestDescription(description perf.TestDescription) bool {
+	set := false
+	c.testDescriptionOnce.Do(func() {
+		c.testDescription = description
+		close(c.testDescriptionDone)
+		set = true
+	})
+	return set
+}
+
+// awaitTestDescription returns the accepted test description, or the zero value if there is none.
+// Returns false if the connection is closed before.
+func (c *connection) awaitTestDescription() (perf.TestDescription, bool) {
+	select {
+	case <-c.testDescriptionDone:
+		return c.testDescription, true
+	case <-c.Context().Done():
+		return perf.TestDescription{}, false
+	}
+}
+
+// allows returns an error if the client announced other directions in its test description.
+// All directions are allowed if the client did not announce any.
+// It waits for the test description, the control stream precedes all request streams.
+func (c *connection) allows(direction perf.Direction) error {
+	if !perf.SupportsExtensions(c.alpn) {
+		return nil
+	}
+	description, ok := c.awaitTestDescription()
+	if ok && description.Direction != 0 && description.Direction&direction == 0 {
+		return fmt.Errorf("%w: %s was not announced", perf.ErrInvalidMessage, direction)
+	}
+	return nil
+}
+
+// verifies returns true if the client enabled verification, it waits for the test description
+func (c *connection) verifies() bool {
+	if !perf.SupportsExtensions(c.alpn) {
+		return false
+	}
+	description, _ := c.awaitTestDescription()
+	return description.Verify
+}
+
+func (c *connection) reportVerification(result perf.VerificationResult) {
+	c.verifiedBytes.Add(result.VerifiedBytes)
+	if result.Failed {
+		c.failedStreams.Add(1)
+	} else if result.Complete {
+		c.verifiedStreams.Add(1)
+	}
+	if c.config.OnVerification != nil {
+		c.config.OnVerification(c, result)
+	}
+}
+
+func (c *connection) runUniStreamAcceptLoop() error {
+	for {
+		stream, err := c.quicConnection.AcceptUniStream(c.Context())
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := c.handleUniStream(stream)
+			if err != nil {
+				c.close(err)
+			}
+		}()
+	}
+}
+
+func (c *connection) handleUniStream(stream quic.ReceiveStream) error {
+	var buf [1]byte
+	_, err := io.ReadFull(stream, buf[:])
+	if err != nil {
+		return err
+	}
+	switch perf.MessageType(buf[0]) {
+	case perf.MessageTypeResultsRequest:
+		return c.sendResults()
+	default:
+		return fmt.Errorf("%w: unexpected stream type %d", perf.ErrInvalidMessage, buf[0])
+	}
+}
+
+func (c *connection) sendResults() error {
+	stream, err := c.quicConnection.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	results := perf.Results{
+		ReceivedStreamBytes:   c.receivedBytes.Load(),
+		SentStreamBytes:       c.sentBytes.Load(),
+		ReceivedDatagramBytes: c.receivedDatagramBytes.Load(),
+		ReceivedDatagrams:     c.receivedDatagrams.Load(),
+		Duration:              time.Since(c.startTime),
+		VerifiedStreams:       c.verifiedStreams.Load(),
+		FailedStreams:         c.failedStreams.Load(),
+		VerifiedBytes:         c.verifiedBytes.Load(),
+	}
+	_, err = stream.Write(results.Append(nil))
+	if err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
 func (c *connection) close(err error) {
 	c.closeOnce.Do(func() {
-		if err != nil {
+		if perf.IsProtocolError(err) {
+			err := c.quicConnection.CloseWithError(errors.ProtocolErrorCode, err.Error())
+			c.err = err
+		} else if err != nil {
 			err := c.quicConnection.CloseWithError(errors.InternalErrorCode, "internal error")
 			c.err = err
 		} else {
@@ -133,3 +427,11 @@ func (c *connection) TracingID() quic.ConnectionTracingID {
 func (c *connection) QuicConn() quic.Connection {
 	return c.quicConnection
 }
+
+func (c *connection) ReceivedBytes() uint64 {
+	return c.receivedBytes.Load()
+}
+
+func (c *connection) SentBytes() uint64 {
+	return c.sentBytes.Load()
+}
@@ -2,10 +2,10 @@ package perf_server
 
 import (
 	"context"
-	"encoding/binary"
 	"github.com/quic-go/quic-go"
 	"io"
 	"qperf-go/common"
+	"qperf-go/common/utils"
 	"qperf-go/perf"
 	"sync"
 	"sync/atomic"
@@ -20,6 +20,10 @@ type RequestReceiveStream interface {
 	Success() bool
 	StreamID() quic.StreamID
 	ResponseDelay() time.Duration
+	// ResponseBitrate in bits per second, 0 means unlimited
+	ResponseBitrate() uint64
+	// ResponseBurst in bytes, 0 means default
+	ResponseBurst() uint64
 }
 
 type requestReceiveStream struct {
@@ -27,12 +31,16 @@ type requestReceiveStream struct {
 	connection     *connection
 	responseLength uint64
 	responseDelay  time.Duration
-	ctx            context.Context
-	ctxCancel      context.CancelFunc
-	receivedBytes  atomic.Uint64
-	success        bool
-	closeOnce      sync.Once
-	err            error
+	// in bits per second
+	responseBitrate uint64
+	// in bytes
+	responseBurst uint64
+	ctx           context.Context
+	ctxCancel     context.CancelFunc
+	receivedBytes atomic.Uint64
+	success       bool
+	closeOnce     sync.Once
+	err           error
 }
 
 func newRequestReceiveStream(quicStream quic.ReceiveStream, connection *connection) (RequestReceiveStream, error) {
@@ -51,20 +59,64 @@ func newRequestReceiveStream(quicStream quic.ReceiveStream, connection *connecti
 }
 
 func (s *requestReceiveStream) run() error {
-	var buf [12]byte
-	reader := common.NewCountingReader(s.quicStream, func(n int) {
-		s.receivedBytes.Add(uint64(n))
-	})
-
-	_, err := io.ReadAtLeast(reader, buf[:], 12)
-	if err != nil && err != io.EOF {
+	buf := make([]byte, perf.RequestHeaderLength(s.connection.alpn))
+	_, err := io.ReadFull(s.quicStream, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.ctxCancel()
+		return perf.ErrRequestHeaderTooShort
+	}
+	if err != nil {
 		s.ctxCancel()
 		return err
 	}
-	s.responseLength = binary.LittleEndian.Uint64(buf[0:8])
-	s.responseDelay = time.Duration(binary.LittleEndian.Uint32(buf[8:12])) * time.Millisecond
+	header, err := perf.ParseRequestHeader(buf, s.connection.alpn)
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+	if header.ResponseLength != 0 {
+		err = s.connection.allows(perf.DirectionDownload)
+		if err != nil {
+			s.ctxCancel()
+			return err
+		}
+	}
+	s.responseLength = header.ResponseLength
+	s.responseDelay = header.ResponseDelay
+	s.responseBitrate = header.ResponseBitrate
+	s.responseBurst = uint64(header.ResponseBurst)
 
-	_, err = io.Copy(io.Discard, reader)
+	var payload io.Writer = io.Discard
+	var verifier *perf.PatternVerifier
+	if s.connection.verifies() {
+		verifier = perf.NewPatternVerifier(s.quicStream.StreamID(), false, uint64(len(buf)))
+		payload = verifier
+	}
+	// only the payload is counted
+	reader := common.NewCountingReader(s.quicStream, func(n int) {
+		s.receivedBytes.Add(uint64(n))
+		s.connection.receivedBytes.Add(uint64(n))
+	})
+	reported := false
+	uploadAllowed := false
+	_, err = io.Copy(utils.FuncToWriter(func(p []byte) (int, error) {
+		if !uploadAllowed {
+			err := s.connection.allows(perf.DirectionUpload)
+			if err != nil {
+				return 0, err
+			}
+			uploadAllowed = true
+		}
+		n, err := payload.Write(p)
+		if verifier != nil && !reported && verifier.Failed() {
+			reported = true
+			s.connection.reportVerification(verifier.Result(false))
+		}
+		return n, err
+	}), reader)
+	if verifier != nil && !reported {
+		s.connection.reportVerification(verifier.Result(err == nil))
+	}
 	if err != nil {
 		s.ctxCancel()
 		return err
@@ -83,6 +135,14 @@ func (s *requestReceiveStream) ResponseDelay() time.Duration {
 	return s.responseDelay
 }
 
+func (s *requestReceiveStream) ResponseBitrate() uint64 {
+	return s.responseBitrate
+}
+
+func (s *requestReceiveStream) ResponseBurst() uint64 {
+	return s.responseBurst
+}
+
 func (s *requestReceiveStream) Context() context.Context {
 	return s.ctx
 }
@@ -98,17 +158,15 @@ func (s *requestReceiveStream) StreamID() quic.StreamID {
 func (s *requestReceiveStream) close(err error) {
 	s.closeOnce.Do(func() {
 		s.err = err
-		s.closeOnce.Do(func() {
-			switch err := err.(type) {
-			case *quic.StreamError:
-				switch err.ErrorCode {
-				case perf.DeadlineExceededStreamErrorCode:
-				default:
-					s.connection.close(err)
-				}
+		switch err := err.(type) {
+		case *quic.StreamError:
+			switch err.ErrorCode {
+			case perf.DeadlineExceededStreamErrorCode:
 			default:
 				s.connection.close(err)
 			}
-		})
+		default:
+			s.connection.close(err)
+		}
 	})
 }
@@ -15,22 +15,30 @@ type ResponseSendStream interface {
 	Context() context.Context
 	Length() uint64
 	Delay() time.Duration
+	// Bitrate in bits per second, 0 means unlimited
+	Bitrate() uint64
 	Cancel()
 }
 
 type responseSendStream struct {
 	quicStream quic.SendStream
 	// in bytes
-	length     uint64
-	delay      time.Duration
+	length uint64
+	delay  time.Duration
+	// in bits per second
+	bitrate uint64
+	// in bytes
+	burst      uint64
 	connection *connection
 }
 
-func newResponseSendStream(quicStream quic.SendStream, length uint64, delay time.Duration, connection *connection) ResponseSendStream {
+func newResponseSendStream(quicStream quic.SendStream, length uint64, delay time.Duration, bitrate uint64, burst uint64, connection *connection) ResponseSendStream {
 	s := &responseSendStream{
 		quicStream: quicStream,
 		length:     length,
 		delay:      delay,
+		bitrate:    bitrate,
+		burst:      burst,
 		connection: connection,
 	}
 	go func() {
@@ -55,7 +63,18 @@ func (s *responseSendStream) run() error {
 	time.Sleep(s.delay)
 	var buf [65536]byte
 	bytesToWrite := s.length
-	_, err := io.CopyBuffer(s.quicStream, common.LimitReader(utils.InfiniteReader{}, bytesToWrite), buf[:])
+	reader := s.connection.config.Payload.NewReader()
+	if s.connection.verifies() {
+		reader = perf.NewPatternReader(s.quicStream.StreamID(), true)
+	}
+	if s.bitrate != 0 {
+		reader = common.NewPacedReader(reader, common.NewTokenBucket(s.bitrate, s.burst))
+	}
+	sendStream := io.MultiWriter(s.quicStream, utils.FuncToWriter(func(p []byte) (n int, err error) {
+		s.connection.sentBytes.Add(uint64(len(p)))
+		return len(p), nil
+	}))
+	_, err := io.CopyBuffer(sendStream, common.LimitReader(reader, bytesToWrite), buf[:])
 	if err != nil {
 		return err
 	}
@@ -79,6 +98,10 @@ func (s *responseSendStream) Delay() time.Duration {
 	return s.delay
 }
 
+func (s *responseSendStream) Bitrate() uint64 {
+	return s.bitrate
+}
+
 func (s *responseSendStream) Cancel() {
 	s.quicStream.CancelWrite(perf.DeadlineExceededStreamErrorCode)
 }
@@ -49,7 +49,7 @@ func (s *server) run() error {
 	for {
 		quicConn, err := s.listener.Accept(s.ctx)
 		if err != nil {
-			s.close(err)
+			return err
 		}
 		NewConnection(quicConn, s.config)
 	}
@@ -0,0 +1,66 @@
+package perf
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// DraftRequestHeaderLength is the length of the request header with ALPN,
+// the response length (8 byte, big-endian).
+const DraftRequestHeaderLength = 8
+
+// QperfRequestHeaderLength is the length of the request header with QperfALPN.
+// It contains the response length (8 byte), the response delay in milliseconds (4 byte),
+// the bitrate of the response in bits per second (8 byte) and the burst size in bytes (4 byte), all big-endian.
+const QperfRequestHeaderLength = 24
+
+var ErrRequestHeaderTooShort = errors.New("request header too short")
+
+// RequestHeader is sent at the start of every request stream, followed by the request payload.
+type RequestHeader struct {
+	ResponseLength uint64
+	// ResponseDelay is the time the server waits until responding, only with QperfALPN
+	ResponseDelay time.Duration
+	// ResponseBitrate in bits per second, 0 means unlimited, only with QperfALPN
+	ResponseBitrate uint64
+	// ResponseBurst in bytes, 0 means default, only with QperfALPN
+	ResponseBurst uint32
+}
+
+// RequestHeaderLength returns the length of the request header for the negotiated ALPN.
+func RequestHeaderLength(alpn string) int {
+	if SupportsExtensions(alpn) {
+		return QperfRequestHeaderLength
+	}
+	return DraftRequestHeaderLength
+}
+
+// Append encodes the header in the format of the negotiated ALPN.
+// The extension fields are not encoded with ALPN.
+func (h RequestHeader) Append(b []byte, alpn string) []byte {
+	b = binary.BigEndian.AppendUint64(b, h.ResponseLength)
+	if !SupportsExtensions(alpn) {
+		return b
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(h.ResponseDelay.Milliseconds()))
+	b = binary.BigEndian.AppendUint64(b, h.ResponseBitrate)
+	b = binary.BigEndian.AppendUint32(b, h.ResponseBurst)
+	return b
+}
+
+// ParseRequestHeader decodes a header in the format of the negotiated ALPN.
+func ParseRequestHeader(b []byte, alpn string) (RequestHeader, error) {
+	if len(b) < RequestHeaderLength(alpn) {
+		return RequestHeader{}, ErrRequestHeaderTooShort
+	}
+	h := RequestHeader{
+		ResponseLength: binary.BigEndian.Uint64(b[0:8]),
+	}
+	if SupportsExtensions(alpn) {
+		h.ResponseDelay = time.Duration(binary.BigEndian.Uint32(b[8:12])) * time.Millisecond
+		h.ResponseBitrate = binary.BigEndian.Uint64(b[12:20])
+		h.ResponseBurst = binary.BigEndian.Uint32(b[20:24])
+	}
+	return h, nil
+}
@@ -0,0 +1,33 @@
+package perf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRequestHeader(t *testing.T) {
+	header := RequestHeader{
+		ResponseLength:  0x0102030405060708,
+		ResponseDelay:   10 * time.Millisecond,
+		ResponseBitrate: 1_000_000,
+		ResponseBurst:   64_000,
+	}
+
+	// only the response length is sent with ALPN
+	draft := header.Append(nil, ALPN)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, draft)
+	parsed, err := ParseRequestHeader(draft, ALPN)
+	require.NoError(t, err)
+	assert.Equal(t, RequestHeader{ResponseLength: header.ResponseLength}, parsed)
+
+	qperf := header.Append(nil, QperfALPN)
+	assert.Len(t, qperf, QperfRequestHeaderLength)
+	parsed, err = ParseRequestHeader(qperf, QperfALPN)
+	require.NoError(t, err)
+	assert.Equal(t, header, parsed)
+
+	_, err = ParseRequestHeader(draft, QperfALPN)
+	assert.ErrorIs(t, err, ErrRequestHeaderTooShort)
+}
@@ -0,0 +1,86 @@
+package perf
+
+import (
+	"encoding/binary"
+	"errors"
+	"qperf-go/common"
+	"time"
+)
+
+// ResultsLength is the length of the message type and the fields of Results that are always encoded.
+const ResultsLength = 1 + 5*8
+
+// MaxResultsLength limits the length of received results including unknown trailing fields.
+const MaxResultsLength = 1024
+
+// Results is the view of the server on a connection.
+// The client requests them by a unidirectional stream containing MessageTypeResultsRequest,
+// the server responds with a unidirectional stream containing MessageTypeResults followed by the results.
+// Fields added later follow the first five fields, they are zero if the peer did not send them.
+// Unknown trailing fields of newer peers are ignored.
+type Results struct {
+	// request headers are not counted
+	ReceivedStreamBytes uint64
+	SentStreamBytes     uint64
+	// only payload datagrams are counted
+	ReceivedDatagramBytes uint64
+	ReceivedDatagrams     uint64
+	// time since the connection was accepted
+	Duration time.Duration
+	// verification of the request streams, see VerificationResult
+	VerifiedStreams uint64
+	FailedStreams   uint64
+	VerifiedBytes   uint64
+}
+
+var ErrInvalidResults = errors.New("invalid results")
+
+// Append encodes the results including the message type, all fields big-endian.
+func (r Results) Append(b []byte) []byte {
+	b = append(b, byte(MessageTypeResults))
+	b = binary.BigEndian.AppendUint64(b, r.ReceivedStreamBytes)
+	b = binary.BigEndian.AppendUint64(b, r.SentStreamBytes)
+	b = binary.BigEndian.AppendUint64(b, r.ReceivedDatagramBytes)
+	b = binary.BigEndian.AppendUint64(b, r.ReceivedDatagrams)
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Duration.Nanoseconds()))
+	b = binary.BigEndian.AppendUint64(b, r.VerifiedStreams)
+	b = binary.BigEndian.AppendUint64(b, r.FailedStreams)
+	b = binary.BigEndian.AppendUint64(b, r.VerifiedBytes)
+	return b
+}
+
+// ParseResults decodes results including the message type.
+func ParseResults(b []byte) (Results, error) {
+	if len(b) < ResultsLength || MessageType(b[0]) != MessageTypeResults {
+		return Results{}, ErrInvalidResults
+	}
+	r := Results{
+		ReceivedStreamBytes:   binary.BigEndian.Uint64(b[1:9]),
+		SentStreamBytes:       binary.BigEndian.Uint64(b[9:17]),
+		ReceivedDatagramBytes: binary.BigEndian.Uint64(b[17:25]),
+		ReceivedDatagrams:     binary.BigEndian.Uint64(b[25:33]),
+		Duration:              time.Duration(binary.BigEndian.Uint64(b[33:41])),
+	}
+	for i, field := range []*uint64{&r.VerifiedStreams, &r.FailedStreams, &r.VerifiedBytes} {
+		offset := ResultsLength + i*8
+		if len(b) < offset+8 {
+			break
+		}
+		*field = binary.BigEndian.Uint64(b[offset : offset+8])
+	}
+	return r, nil
+}
+
+// Add sums up the results of multiple connections, the duration is the maximum.
+func (r Results) Add(other Results) Results {
+	return Results{
+		ReceivedStreamBytes:   r.ReceivedStreamBytes + other.ReceivedStreamBytes,
+		SentStreamBytes:       r.SentStreamBytes + other.SentStreamBytes,
+		ReceivedDatagramBytes: r.ReceivedDatagramBytes + other.ReceivedDatagramBytes,
+		ReceivedDatagrams:     r.ReceivedDatagrams + other.ReceivedDatagrams,
+		Duration:              common.Max(r.Duration, other.Duration),
+		VerifiedStreams:       r.VerifiedStreams + other.VerifiedStreams,
+		FailedStreams:         r.FailedStreams + other.FailedStreams,
+		VerifiedBytes:         r.VerifiedBytes + other.VerifiedBytes,
+	}
+}
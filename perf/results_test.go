@@ -0,0 +1,44 @@
+package perf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestResults(t *testing.T) {
+	results := Results{
+		ReceivedStreamBytes:   1,
+		SentStreamBytes:       2,
+		ReceivedDatagramBytes: 3,
+		ReceivedDatagrams:     4,
+		Duration:              time.Second,
+		VerifiedStreams:       5,
+		FailedStreams:         6,
+		VerifiedBytes:         7,
+	}
+	encoded := results.Append(nil)
+	parsed, err := ParseResults(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, results, parsed)
+
+	// peers without verification send the first five fields only
+	parsed, err = ParseResults(encoded[:ResultsLength])
+	require.NoError(t, err)
+	assert.Equal(t, Results{
+		ReceivedStreamBytes:   1,
+		SentStreamBytes:       2,
+		ReceivedDatagramBytes: 3,
+		ReceivedDatagrams:     4,
+		Duration:              time.Second,
+	}, parsed)
+
+	// unknown fields of newer peers are ignored
+	parsed, err = ParseResults(append(encoded, 1, 2, 3, 4, 5, 6, 7, 8, 9))
+	require.NoError(t, err)
+	assert.Equal(t, results, parsed)
+
+	_, err = ParseResults(encoded[:ResultsLength-1])
+	assert.ErrorIs(t, err, ErrInvalidResults)
+}
@@ -0,0 +1,197 @@
+package perf_integration_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"qperf-go/common"
+	"qperf-go/errors"
+	"qperf-go/perf"
+	"qperf-go/perf/perf_client"
+	"qperf-go/perf/perf_server"
+	"testing"
+	"time"
+)
+
+func TestControlStreamRejectsUnknownCriticalParameter(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, server.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{perf.QperfALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second})
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStream()
+	require.NoError(t, err)
+	// version 1 with the unknown critical parameter 0x81 and an empty value
+	_, err = stream.Write([]byte{byte(perf.MessageTypeTestDescription), 4, 1, 0x40, 0x81, 0})
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	messageType, payload, err := perf.ReadControlMessage(stream)
+	require.NoError(t, err)
+	assert.Equal(t, perf.MessageTypeTestAcknowledgement, messageType)
+	ack, err := perf.ParseTestAcknowledgement(payload)
+	require.NoError(t, err)
+	assert.Equal(t, perf.ControlErrorUnsupportedParameter, ack.ErrorCode)
+}
+
+func TestControlStream(t *testing.T) {
+	descriptions := make(chan perf.TestDescription, 1)
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+		OnTestDescription: func(conn perf_server.Connection, description perf.TestDescription) {
+			descriptions <- description
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := perf_client.DialAddr(
+		server.Addr().String(),
+		&perf_client.Config{
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			Bitrate: 1_000_000,
+			TestDescription: &perf.TestDescription{
+				Duration:  time.Second,
+				Direction: perf.DirectionDownload,
+			},
+		},
+		false,
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	select {
+	case description := <-descriptions:
+		assert.Equal(t, perf.TestDescription{
+			Version:      perf.ControlProtocolVersion,
+			Duration:     time.Second,
+			Bitrate:      1_000_000,
+			DatagramSize: perf.DefaultDatagramSize,
+			Direction:    perf.DirectionDownload,
+		}, description)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	// the control stream does not count as request
+	_, respStream, err := client.Request(perf.QperfRequestHeaderLength, 1000, 0)
+	require.NoError(t, err)
+	<-respStream.Context().Done()
+	assert.Equal(t, uint64(1000), respStream.ReceivedBytes())
+
+	// only download was announced
+	_, _, err = client.Request(100, 0, 0)
+	require.NoError(t, err)
+	requireProtocolError(t, client.QuicConn())
+}
+
+func TestTestDurationClosesConnection(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: 10 * time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := perf_client.DialAddr(
+		server.Addr().String(),
+		&perf_client.Config{
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: 10 * time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			TestDescription: &perf.TestDescription{
+				Duration: 100 * time.Millisecond,
+			},
+		},
+		false,
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	start := time.Now()
+	select {
+	case <-client.QuicConn().Context().Done():
+	case <-time.After(100*time.Millisecond + perf.TestEndGracePeriod + time.Second):
+		t.Fatal("timeout")
+	}
+	assert.GreaterOrEqual(t, time.Since(start), perf.TestEndGracePeriod)
+	var appErr *quic.ApplicationError
+	require.ErrorAs(t, context.Cause(client.QuicConn().Context()), &appErr)
+	assert.True(t, appErr.Remote)
+	assert.Equal(t, errors.NoError, appErr.ErrorCode)
+}
+
+func TestVerificationFailure(t *testing.T) {
+	results := make(chan perf.VerificationResult, 1)
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+		OnVerification: func(conn perf_server.Connection, result perf.VerificationResult) {
+			results <- result
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, server.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{perf.QperfALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second})
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	controlStream, err := conn.OpenStream()
+	require.NoError(t, err)
+	_, err = controlStream.Write(perf.TestDescription{Version: perf.ControlProtocolVersion, Verify: true}.Append(nil))
+	require.NoError(t, err)
+
+	stream, err := conn.OpenStream()
+	require.NoError(t, err)
+	request := perf.RequestHeader{}.Append(nil, perf.QperfALPN)
+	payload := make([]byte, 10_000)
+	_, err = io.ReadFull(perf.NewPatternReader(stream.StreamID(), false), payload)
+	require.NoError(t, err)
+	payload[5000] ^= 0xff
+	_, err = stream.Write(append(request, payload...))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	select {
+	case result := <-results:
+		assert.True(t, result.Failed)
+		assert.Equal(t, stream.StreamID(), result.StreamID)
+		assert.Equal(t, uint64(perf.QperfRequestHeaderLength+5000), result.MismatchOffset)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,120 @@
+package perf_integration_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"qperf-go/common"
+	"qperf-go/perf"
+	"qperf-go/perf/perf_client"
+	"qperf-go/perf/perf_server"
+	"testing"
+	"time"
+)
+
+// the reference implementations follow Section 2.3 of draft-banks-quic-performance-00:
+// the client sends the response length as 8 byte big-endian integer followed by the request payload,
+// the server responds with the requested number of bytes.
+
+func runReferenceServer(t *testing.T, requestBytes chan<- int) *quic.Listener {
+	listener, err := quic.ListenAddr("localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{common.GenerateCert()},
+		NextProtos:   []string{perf.ALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					request, err := io.ReadAll(stream)
+					if err != nil {
+						return
+					}
+					requestBytes <- len(request)
+					_, _ = stream.Write(make([]byte, binary.BigEndian.Uint64(request[:8])))
+					_ = stream.Close()
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestDraftClientWithReferenceServer(t *testing.T) {
+	requestBytes := make(chan int, 1)
+	listener := runReferenceServer(t, requestBytes)
+	client, err := perf_client.DialAddr(
+		listener.Addr().String(),
+		&perf_client.Config{
+			QuicConfig: &quic.Config{
+				MaxIdleTimeout: time.Second,
+			},
+			TlsConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{perf.ALPN},
+			},
+		},
+		false,
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	_, _, err = client.Request(1000, 1000, time.Millisecond)
+	assert.ErrorIs(t, err, perf.ErrExtensionNotSupported)
+	_, respStream, err := client.Request(1000, 2000, 0)
+	require.NoError(t, err)
+	select {
+	case <-respStream.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(t, respStream.Success())
+	assert.Equal(t, uint64(2000), respStream.ReceivedBytes())
+	assert.Equal(t, 1000, <-requestBytes)
+}
+
+func TestDraftServerWithReferenceClient(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, server.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{perf.ALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second})
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	assert.Equal(t, perf.ALPN, conn.ConnectionState().TLS.NegotiatedProtocol)
+	stream, err := conn.OpenStream()
+	require.NoError(t, err)
+	request := binary.BigEndian.AppendUint64(nil, 3000)
+	request = append(request, make([]byte, 100)...)
+	_, err = stream.Write(request)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	response, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Len(t, response, 3000)
+}
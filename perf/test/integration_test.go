@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"qperf-go/common"
+	"qperf-go/perf"
 	"qperf-go/perf/perf_client"
 	"qperf-go/perf/perf_server"
 	"testing"
@@ -58,6 +59,12 @@ func TestSingleRequest(t *testing.T) {
 	assert.Equal(t, context.Canceled, respStream.Context().Err())
 	assert.True(t, respStream.Success())
 	assert.Equal(t, uint64(1000), respStream.ReceivedBytes())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	results, err := client.RequestResults(ctx)
+	require.NoError(t, err)
+	// the server does not count the request header
+	assert.Equal(t, uint64(1000-perf.RequestHeaderLength(perf.QperfALPN)), results.ReceivedStreamBytes)
 	err = client.Close()
 	assert.NoError(t, err)
 }
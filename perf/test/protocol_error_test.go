@@ -0,0 +1,189 @@
+package perf_integration_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"qperf-go/common"
+	"qperf-go/errors"
+	"qperf-go/perf"
+	"qperf-go/perf/perf_client"
+	"qperf-go/perf/perf_server"
+	"testing"
+	"time"
+)
+
+func dialRaw(t *testing.T, addr string, alpn string) quic.Connection {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{alpn},
+	}, &quic.Config{MaxIdleTimeout: time.Second, EnableDatagrams: true})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.CloseWithError(0, "")
+	})
+	return conn
+}
+
+func requireProtocolError(t *testing.T, conn quic.Connection) {
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	var appErr *quic.ApplicationError
+	require.ErrorAs(t, context.Cause(conn.Context()), &appErr)
+	assert.True(t, appErr.Remote)
+	assert.Equal(t, errors.ProtocolErrorCode, appErr.ErrorCode)
+}
+
+func TestInvalidDatagramClosesOnlyItsConnection(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout:  time.Second,
+			EnableDatagrams: true,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+
+	for _, datagram := range [][]byte{{}, {0xff}} {
+		conn := dialRaw(t, server.Addr().String(), perf.QperfALPN)
+		require.NoError(t, conn.SendDatagram(datagram))
+		requireProtocolError(t, conn)
+	}
+
+	// the server still accepts connections
+	client, err := perf_client.DialAddr(server.Addr().String(), &perf_client.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}, false)
+	require.NoError(t, err)
+	defer client.Close()
+	_, respStream, err := client.Request(1000, 1000, 0)
+	require.NoError(t, err)
+	select {
+	case <-respStream.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(t, respStream.Success())
+}
+
+func TestInvalidUniStreamClosesConnection(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	conn := dialRaw(t, server.Addr().String(), perf.QperfALPN)
+	stream, err := conn.OpenUniStream()
+	require.NoError(t, err)
+	_, err = stream.Write([]byte{0xff})
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	requireProtocolError(t, conn)
+}
+
+func TestTruncatedRequestHeaderClosesConnection(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	for _, alpn := range []string{perf.ALPN, perf.QperfALPN} {
+		conn := dialRaw(t, server.Addr().String(), alpn)
+		stream, err := conn.OpenStream()
+		require.NoError(t, err)
+		if alpn == perf.QperfALPN {
+			// the first stream is the control stream
+			_, err = stream.Write(perf.TestDescription{Version: perf.ControlProtocolVersion}.Append(nil))
+			require.NoError(t, err)
+			require.NoError(t, stream.Close())
+			stream, err = conn.OpenStream()
+			require.NoError(t, err)
+		}
+		_, err = stream.Write([]byte{0, 0, 0})
+		require.NoError(t, err)
+		require.NoError(t, stream.Close())
+		requireProtocolError(t, conn)
+	}
+}
+
+func TestDatagramRequestWithoutControlStream(t *testing.T) {
+	server, err := perf_server.ListenAddr("localhost:0", &perf_server.Config{
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout:  time.Second,
+			EnableDatagrams: true,
+		},
+		TlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{common.GenerateCert()},
+		},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+	conn := dialRaw(t, server.Addr().String(), perf.QperfALPN)
+	require.NoError(t, conn.SendDatagram(perf.NewDatagramRequest(0, 0)))
+
+	// the server falls back to the defaults after perf.ControlStreamTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), perf.ControlStreamTimeout+time.Second)
+	defer cancel()
+	datagram, err := conn.ReceiveDatagram(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, byte(perf.MessageTypeDatagramPayload), datagram[0])
+	assert.LessOrEqual(t, len(datagram), perf.DefaultDatagramSize)
+}
+
+func TestDialFailsIfControlStreamIsRefused(t *testing.T) {
+	// the server does not allow the client to open any bidirectional stream
+	listener, err := quic.ListenAddr("localhost:0", &tls.Config{
+		Certificates: []tls.Certificate{common.GenerateCert()},
+		NextProtos:   []string{perf.QperfALPN},
+	}, &quic.Config{MaxIdleTimeout: time.Second, MaxIncomingStreams: -1})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			_, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := perf_client.DialAddr(listener.Addr().String(), &perf_client.Config{
+			QuicConfig: &quic.Config{MaxIdleTimeout: time.Second},
+			TlsConfig:  &tls.Config{InsecureSkipVerify: true},
+		}, false)
+		errChan <- err
+	}()
+	select {
+	case err := <-errChan:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+}
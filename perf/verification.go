@@ -0,0 +1,93 @@
+package perf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/quic-go/quic-go"
+	"io"
+	"math/rand/v2"
+)
+
+// NewPatternReader returns the payload of a verified stream,
+// a deterministic pseudo-random pattern seeded by the stream ID and the direction.
+// Request streams start with the pattern after the request header.
+func NewPatternReader(streamID quic.StreamID, response bool) io.Reader {
+	var seed [32]byte
+	binary.BigEndian.PutUint64(seed[:], uint64(streamID))
+	if response {
+		seed[8] = 1
+	}
+	return rand.NewChaCha8(seed)
+}
+
+// VerificationResult of a received stream
+type VerificationResult struct {
+	StreamID quic.StreamID
+	// Response is true for response streams, false for request streams
+	Response bool
+	// VerifiedBytes is the number of payload bytes that matched the pattern
+	VerifiedBytes uint64
+	// Complete is true if the stream was received completely
+	Complete bool
+	Failed   bool
+	// MismatchOffset is the stream offset of the first mismatching byte, only valid if Failed
+	MismatchOffset uint64
+}
+
+// PatternVerifier compares the written payload with the pattern of NewPatternReader.
+// The payload is discarded, comparing stops at the first mismatch.
+type PatternVerifier struct {
+	pattern  io.Reader
+	expected []byte
+	// stream offset of the next written byte
+	offset uint64
+	result VerificationResult
+}
+
+var _ io.Writer = &PatternVerifier{}
+
+// NewPatternVerifier starts verifying at the given stream offset, e.g. after the request header.
+func NewPatternVerifier(streamID quic.StreamID, response bool, offset uint64) *PatternVerifier {
+	return &PatternVerifier{
+		pattern: NewPatternReader(streamID, response),
+		offset:  offset,
+		result: VerificationResult{
+			StreamID: streamID,
+			Response: response,
+		},
+	}
+}
+
+func (v *PatternVerifier) Write(p []byte) (int, error) {
+	if !v.result.Failed {
+		if len(v.expected) < len(p) {
+			v.expected = make([]byte, len(p))
+		}
+		expected := v.expected[:len(p)]
+		_, _ = io.ReadFull(v.pattern, expected)
+		if bytes.Equal(p, expected) {
+			v.result.VerifiedBytes += uint64(len(p))
+		} else {
+			i := 0
+			for p[i] == expected[i] {
+				i++
+			}
+			v.result.VerifiedBytes += uint64(i)
+			v.result.Failed = true
+			v.result.MismatchOffset = v.offset + uint64(i)
+		}
+	}
+	v.offset += uint64(len(p))
+	return len(p), nil
+}
+
+func (v *PatternVerifier) Failed() bool {
+	return v.result.Failed
+}
+
+// Result returns the result so far, complete marks the stream as completely received
+func (v *PatternVerifier) Result(complete bool) VerificationResult {
+	result := v.result
+	result.Complete = complete
+	return result
+}
@@ -0,0 +1,40 @@
+package perf
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+func readPattern(t *testing.T, reader io.Reader, n int) []byte {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(reader, buf)
+	assert.NoError(t, err)
+	return buf
+}
+
+func TestPatternReader(t *testing.T) {
+	pattern := readPattern(t, NewPatternReader(4, false), 1000)
+	assert.Equal(t, pattern, readPattern(t, NewPatternReader(4, false), 1000))
+	assert.NotEqual(t, pattern, readPattern(t, NewPatternReader(4, true), 1000))
+	assert.NotEqual(t, pattern, readPattern(t, NewPatternReader(8, false), 1000))
+}
+
+func TestPatternVerifier(t *testing.T) {
+	pattern := readPattern(t, NewPatternReader(4, true), 100_000)
+	verifier := NewPatternVerifier(4, true, 0)
+	_, err := io.CopyBuffer(verifier, bytes.NewReader(pattern), make([]byte, 1000))
+	assert.NoError(t, err)
+	assert.Equal(t, VerificationResult{StreamID: 4, Response: true, VerifiedBytes: 100_000, Complete: true}, verifier.Result(true))
+
+	pattern[12_345] ^= 1
+	verifier = NewPatternVerifier(4, true, 24)
+	_, err = io.CopyBuffer(verifier, bytes.NewReader(pattern), make([]byte, 1000))
+	assert.NoError(t, err)
+	result := verifier.Result(true)
+	assert.True(t, result.Failed)
+	assert.Equal(t, uint64(12_345), result.VerifiedBytes)
+	// the offset includes the start offset
+	assert.Equal(t, uint64(24+12_345), result.MismatchOffset)
+}
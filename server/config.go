@@ -12,7 +12,8 @@ import (
 )
 
 const (
-	DefaultQlogTitle = "qperf"
+	DefaultQlogTitle      = "qperf"
+	DefaultReportInterval = 1 * time.Second
 )
 
 func getDefaultQlogCodeVersion() string {
@@ -25,7 +26,11 @@ func getDefaultQlogCodeVersion() string {
 
 type Config struct {
 	// output path of qlog file. {odcid} is substituted.
-	QlogConfig            *qlog2.Config
+	QlogConfig *qlog2.Config
+	// OutputFormat of stdout, if QLOGDIR is not set
+	OutputFormat common.OutputFormat
+	// PrintRaw disables metric prefixes in the text output
+	PrintRaw              bool
 	PerfConfig            *perf_server.Config
 	Use0RTTStateRequest   bool
 	ConnectionIDGenerator quic.ConnectionIDGenerator
@@ -39,6 +44,10 @@ type Config struct {
 	PileInterval      time.Duration
 	PileDuration      time.Duration
 	Events            []common.Event
+	// ReportInterval is the time between the reports of every connection
+	ReportInterval time.Duration
+	// Emulation impairs the packets of all connections, nil if disabled
+	Emulation *common.EmulationConfig
 }
 
 func (c *Config) Populate() *Config {
@@ -58,6 +67,9 @@ func (c *Config) Populate() *Config {
 		c.QlogConfig.CodeVersion = getDefaultQlogCodeVersion()
 	}
 	c.QlogConfig.Populate()
+	if c.ReportInterval == 0 {
+		c.ReportInterval = DefaultReportInterval
+	}
 	c.PerfConfig = c.PerfConfig.Populate()
 	if c.SessionTicketKey != nil {
 		c.PerfConfig.TlsConfig.SetSessionTicketKeys([][32]byte{*c.SessionTicketKey})
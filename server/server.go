@@ -34,9 +34,18 @@ type server struct {
 	cancelCtx   context.CancelFunc
 	mutex       sync.Mutex // for fields: connections
 	connections map[quic.ConnectionTracingID]perf_server.Connection
-	transport   quic.Transport
+	// created by the tracer, before the connection is accepted
+	states    map[quic.ConnectionTracingID]*connectionState
+	transport quic.Transport
 	// closed when client is stopping and doing some final output, goroutine waiting and cleanup
 	stopping chan struct{}
+	// waits for the final reports of all connections
+	reportLoops sync.WaitGroup
+}
+
+type connectionState struct {
+	state *common.State
+	odcid logging.ConnectionID
 }
 
 func (s *server) Addr() net.Addr {
@@ -59,14 +68,19 @@ func Listen(addr string, config *Config) (Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	var packetConn net.PacketConn = udpConn
+	if config != nil && config.Emulation != nil {
+		packetConn = common.NewEmulatedConn(udpConn, config.Emulation)
+	}
 
 	config = config.Populate()
 	s := &server{
 		config:      config,
 		connections: map[quic.ConnectionTracingID]perf_server.Connection{},
+		states:      map[quic.ConnectionTracingID]*connectionState{},
 		stopping:    make(chan struct{}),
 		transport: quic.Transport{
-			Conn:                  udpConn,
+			Conn:                  packetConn,
 			ConnectionIDGenerator: config.ConnectionIDGenerator,
 			StatelessResetKey:     config.StatelessResetKey,
 			TokenGeneratorKey:     config.AddressTokenKey,
@@ -81,11 +95,51 @@ func Listen(addr string, config *Config) (Server, error) {
 	}
 
 	if s.qlog == nil {
-		s.qlog = qlog2.NewStdoutQlogWriter(s.config.QlogConfig)
+		s.qlog = common.NewStdoutWriter(s.config.OutputFormat, s.config.PrintRaw, s.config.QlogConfig)
 	}
 	s.config.PerfConfig.Qlog = s.qlog
 
-	s.config.PerfConfig.QuicConfig.Tracer = appendQperfTracer(s.config.PerfConfig.QuicConfig.Tracer, s.qlog)
+	s.config.PerfConfig.QuicConfig.Tracer = common.NewMultiplexedTracer(
+		appendQperfTracer(s.config.PerfConfig.QuicConfig.Tracer, s.qlog),
+		s.newStateTracer,
+	)
+	s.config.PerfConfig.OnDatagramReceive = func(conn perf_server.Connection, sequenceNumber uint64, sendTime time.Time, receiveTime time.Time) {
+		connState := s.connectionState(conn.TracingID())
+		if connState != nil {
+			connState.state.AddReceivedDatagram(0, sequenceNumber, sendTime, receiveTime)
+		}
+	}
+	s.config.PerfConfig.OnTestDescription = func(conn perf_server.Connection, description perf.TestDescription) {
+		connState := s.connectionState(conn.TracingID())
+		if connState == nil {
+			return
+		}
+		odcid := connState.odcid.String()
+		s.qlog.RecordEventWithTimeGroupODCID(common.TestDescriptionEvent{
+			Version:      description.Version,
+			Duration:     description.Duration,
+			Bitrate:      description.Bitrate,
+			Burst:        description.Burst,
+			DatagramSize: description.DatagramSize,
+			Direction:    description.Direction.String(),
+		}, time.Now(), odcid, odcid)
+	}
+
+	s.config.PerfConfig.OnVerification = func(conn perf_server.Connection, result perf.VerificationResult) {
+		connState := s.connectionState(conn.TracingID())
+		if connState == nil {
+			return
+		}
+		connState.state.AddVerificationResult(int64(result.StreamID), result.VerifiedBytes, result.Complete, result.Failed)
+		if result.Failed {
+			odcid := connState.odcid.String()
+			s.qlog.RecordEventWithTimeGroupODCID(common.VerificationFailedEvent{
+				StreamID:  int64(result.StreamID),
+				Direction: "request",
+				Offset:    result.MismatchOffset,
+			}, time.Now(), odcid, odcid)
+		}
+	}
 
 	//TODO add option to disable mtu discovery
 	//TODO add option to enable address prevalidation
@@ -143,6 +197,45 @@ func appendQperfTracer(tracer func(context.Context, logging.Perspective, quic.Co
 	)
 }
 
+// newStateTracer creates the state of a new connection
+func (s *server) newStateTracer(ctx context.Context, perspective logging.Perspective, odcid logging.ConnectionID) *logging.ConnectionTracer {
+	tracingID := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	state := common.NewState()
+	state.SetStartTime()
+	s.mutex.Lock()
+	s.states[tracingID] = &connectionState{
+		state: state,
+		odcid: odcid,
+	}
+	s.mutex.Unlock()
+	stateTracer := common.NewStateTracer(state)
+	stateTracer.OnFlowControlBlocked = func(event common.FlowControlBlockedEvent) {
+		s.qlog.RecordEventWithTimeGroupODCID(event, time.Now(), odcid.String(), odcid.String())
+	}
+	return common.NewMultiplexedTracer(
+		stateTracer.TracerForConnection,
+		func(_ context.Context, _ logging.Perspective, _ logging.ConnectionID) *logging.ConnectionTracer {
+			return &logging.ConnectionTracer{
+				ClosedConnection: func(err error) {
+					// remove state if connection is never accepted
+					s.mutex.Lock()
+					if _, ok := s.connections[tracingID]; !ok {
+						delete(s.states, tracingID)
+					}
+					s.mutex.Unlock()
+				},
+			}
+		},
+	)(ctx, perspective, odcid)
+}
+
+// connectionState returns nil if there is no state for the connection
+func (s *server) connectionState(tracingID quic.ConnectionTracingID) *connectionState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.states[tracingID]
+}
+
 // alpn is sometimes not available immediately
 // TODO fix bug in qtls
 func (s *server) getAlpn(conn quic.Connection) string {
@@ -164,7 +257,7 @@ func (s *server) Run() error {
 			return nil
 		}
 		switch alpn := s.getAlpn(quicConnection); alpn {
-		case perf.ALPN:
+		case perf.QperfALPN, perf.ALPN:
 			s.acceptPerf(quicConnection)
 		default:
 			panic(fmt.Sprintf("unexpected ALPN: %s", alpn))
@@ -180,15 +273,23 @@ func (s *server) Close(err error) {
 			s.qlog.RecordEvent(qlog_app.AppInfoEvent{Message: "stop"})
 		}
 		s.mutex.Lock()
+		close(s.stopping)
+		var connections []perf_server.Connection
 		for _, conn := range s.connections {
-			conn.Close()
+			connections = append(connections, conn)
 		}
 		s.mutex.Unlock()
-		close(s.stopping)
+		// do not hold the lock, closing calls the tracer
+		for _, conn := range connections {
+			conn.Close()
+		}
+		s.reportLoops.Wait()
 		if s.listener != nil {
 			s.listener.Close()
 		}
 		s.transport.Close()
+		// not closed by the transport itself
+		_ = s.transport.Conn.Close()
 		s.qlog.Close()
 		s.cancelCtx()
 	})
@@ -197,21 +298,128 @@ func (s *server) Close(err error) {
 
 func (s *server) acceptPerf(quicConn quic.EarlyConnection) {
 	perfConn := perf_server.NewConnection(quicConn, s.config.PerfConfig)
+	if connState := s.connectionState(perfConn.TracingID()); connState != nil {
+		go trackZeroRTT(quicConn, connState.state)
+	}
 	s.addConnectionToList(perfConn)
 }
 
+// trackZeroRTT counts the connection as accepted if it used 0-RTT, once the handshake completed
+func trackZeroRTT(quicConn quic.EarlyConnection, state *common.State) {
+	select {
+	case <-quicConn.HandshakeComplete():
+	case <-quicConn.Context().Done():
+		select {
+		case <-quicConn.HandshakeComplete():
+		default:
+			return
+		}
+	}
+	if quicConn.ConnectionState().Used0RTT {
+		state.AddZeroRTTAccepted()
+	}
+}
+
 func (s *server) addConnectionToList(perfConn perf_server.Connection) {
 	s.mutex.Lock()
+	select {
+	case <-s.stopping:
+		s.mutex.Unlock()
+		perfConn.Close()
+		return
+	default:
+	}
 	s.connections[perfConn.TracingID()] = perfConn
+	connState := s.states[perfConn.TracingID()]
+	if connState != nil {
+		s.reportLoops.Add(1)
+	}
 	s.mutex.Unlock()
 	go func() {
-		<-perfConn.Context().Done()
+		if connState != nil {
+			s.runReportLoop(perfConn, connState)
+			s.reportLoops.Done()
+		} else {
+			<-perfConn.Context().Done()
+		}
 		s.mutex.Lock()
 		delete(s.connections, perfConn.TracingID())
+		delete(s.states, perfConn.TracingID())
 		s.mutex.Unlock()
 	}()
 }
 
+// runReportLoop reports periodically until the connection is closed, then reports the total
+func (s *server) runReportLoop(perfConn perf_server.Connection, connState *connectionState) {
+	for {
+		select {
+		case <-time.After(s.config.ReportInterval):
+			s.report(perfConn, connState, false)
+		case <-perfConn.Context().Done():
+			s.report(perfConn, connState, true)
+			return
+		}
+	}
+}
+
+// report includes only metrics of directions that have been used by the client so far
+func (s *server) report(perfConn perf_server.Connection, connState *connectionState, total bool) {
+	state := connState.state
+	state.SetTotalReceiveStreamBytes(perfConn.ReceivedBytes())
+	state.SetTotalSentStreamBytes(perfConn.SentBytes())
+	totalReport := state.TotalReport()
+	var report common.Report
+	if total {
+		report = totalReport
+	} else {
+		report = state.GetAndResetReport()
+	}
+	now := time.Now()
+	event := &common.ReportEvent{
+		Period: report.TimeAggregated,
+	}
+	if totalReport.ReceivedBytes != 0 {
+		mbps := float32(report.ReceivedBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		event.StreamMegaBitsPerSecondReceived = &mbps
+		event.StreamBytesReceived = &report.ReceivedBytes
+	}
+	if totalReport.SentBytes != 0 {
+		mbps := float32(report.SentBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		event.StreamMegaBitsPerSecondSent = &mbps
+		event.StreamBytesSent = &report.SentBytes
+	}
+	if totalReport.ReceivedDatagrams != 0 {
+		mbps := float32(report.ReceivedDatagramBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		lossPercentage := report.DatagramLossPercentage()
+		event.DatagramMegaBitsPerSecondReceived = &mbps
+		event.DatagramBytesReceived = &report.ReceivedDatagramBytes
+		event.DatagramsReceived = &report.ReceivedDatagrams
+		event.DatagramsLost = &report.LostDatagrams
+		event.DatagramLossPercentage = &lossPercentage
+		event.DatagramsOutOfOrder = &report.OutOfOrderDatagrams
+		event.DatagramsDuplicate = &report.DuplicateDatagrams
+		event.DatagramJitter = &report.DatagramJitter
+	}
+	if totalReport.SentDatagramBytes != 0 {
+		mbps := float32(report.SentDatagramBytes) * 8 / float32(report.TimeAggregated.Seconds()) / float32(1e6)
+		event.DatagramMegaBitsPerSecondSent = &mbps
+		event.DatagramBytesSent = &report.SentDatagramBytes
+	}
+	odcid := connState.odcid.String()
+	if total && report.ZeroRTT.Attempted != 0 {
+		event.ZeroRTT = &report.ZeroRTT
+		s.qlog.RecordEventWithTimeGroupODCID(common.ZeroRTTEvent{ZeroRTTStats: report.ZeroRTT}, now, odcid, odcid)
+	}
+	if total && (report.Verification.BytesVerified != 0 || report.Verification.StreamsFailed != 0) {
+		event.Verification = &report.Verification
+	}
+	if total {
+		s.qlog.RecordEventWithTimeGroupODCID(common.TotalEvent{ReportEvent: *event}, now, odcid, odcid)
+	} else {
+		s.qlog.RecordEventWithTimeGroupODCID(event, now, odcid, odcid)
+	}
+}
+
 func (s *server) runEvent(event common.Event) {
 	switch event.(type) {
 	default: